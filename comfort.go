@@ -0,0 +1,106 @@
+package netatmo
+
+import "math"
+
+// HeatIndex returns the perceived temperature in °C for an air temperature
+// in °C and a relative humidity in percent, using the Rothfusz regression of
+// the US National Weather Service. It is meaningful from about 27 °C.
+func HeatIndex(tempC, humidity float32) float32 {
+	t := float64(tempC)*9/5 + 32
+	rh := float64(humidity)
+	hi := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		6.83783e-3*t*t - 5.481717e-2*rh*rh + 1.22874e-3*t*t*rh +
+		8.5282e-4*t*rh*rh - 1.99e-6*t*t*rh*rh
+	return float32((hi - 32) * 5 / 9)
+}
+
+// WindChill returns the perceived temperature in °C for an air temperature
+// in °C and a wind speed in km/h, using the formula of Environment Canada.
+// It is meaningful below 10 °C with wind above 4.8 km/h.
+func WindChill(tempC, windKmh float32) float32 {
+	t := float64(tempC)
+	v := math.Pow(float64(windKmh), 0.16)
+	return float32(13.12 + 0.6215*t - 11.37*v + 0.3965*t*v)
+}
+
+// metricSource returns the device providing metric for d: the preferred
+// module if d is a station, else d itself.
+func (d *Device) metricSource(metric string) *Device {
+	if m, ok := d.PreferredSource(metric); ok {
+		return m
+	}
+	return d
+}
+
+// ApparentTemperature returns the "feels like" temperature in °C: the wind
+// chill when it is below 10 °C with wind, the heat index above 27 °C with
+// humidity of at least 40%, and the plain temperature otherwise. For a
+// station, the values are taken from its outdoor and wind modules.
+func (d *Device) ApparentTemperature() (float32, bool) {
+	temp := d.metricSource("Temperature").DashboardData.Temperature
+	if temp == nil {
+		return 0, false
+	}
+	wind := d.metricSource("WindStrength").DashboardData.WindStrength
+	humidity := d.metricSource("Humidity").DashboardData.Humidity
+
+	switch {
+	case *temp <= 10 && wind != nil && float32(*wind) > 4.8:
+		return WindChill(*temp, float32(*wind)), true
+	case *temp >= 27 && humidity != nil && *humidity >= 40:
+		return HeatIndex(*temp, float32(*humidity)), true
+	}
+	return *temp, true
+}
+
+// saturationVaporPressure returns the saturation vapor pressure of water in
+// hPa at tempC, using the Magnus formula.
+func saturationVaporPressure(tempC float64) float64 {
+	return 6.112 * math.Exp(17.67*tempC/(tempC+243.5))
+}
+
+// AbsoluteHumidity returns the mass of water vapor in g/m³ for an air
+// temperature in °C and a relative humidity in percent.
+func AbsoluteHumidity(tempC, humidity float32) float32 {
+	t := float64(tempC)
+	vapor := saturationVaporPressure(t) * float64(humidity) / 100 // hPa
+	return float32(216.74 * vapor / (273.15 + t))
+}
+
+// AbsoluteHumidity returns the absolute humidity measured by d in g/m³.
+// ok is false if d does not measure both temperature and humidity.
+func (d *Device) AbsoluteHumidity() (float32, bool) {
+	dd := d.DashboardData
+	if dd.Temperature == nil || dd.Humidity == nil {
+		return 0, false
+	}
+	return AbsoluteHumidity(*dd.Temperature, float32(*dd.Humidity)), true
+}
+
+// DewPoint returns the temperature in °C at which air of temperature tempC
+// in °C and relative humidity in percent becomes saturated, using the Magnus
+// formula.
+func DewPoint(tempC, humidity float32) float32 {
+	t := float64(tempC)
+	gamma := math.Log(float64(humidity)/100) + 17.67*t/(t+243.5)
+	return float32(243.5 * gamma / (17.67 - gamma))
+}
+
+// DewPoint returns the dew point of the air measured by d in °C. ok is
+// false if d does not measure both temperature and humidity.
+func (d *Device) DewPoint() (float32, bool) {
+	dd := d.DashboardData
+	if dd.Temperature == nil || dd.Humidity == nil {
+		return 0, false
+	}
+	return DewPoint(*dd.Temperature, float32(*dd.Humidity)), true
+}
+
+// CondensationRisk reports whether water condenses on a surface at
+// surfaceTemp in °C, such as a cold wall or window, in the air measured by
+// d: the dew point is at or above the surface temperature. Lasting
+// condensation favors mold. It is false if the dew point is unknown.
+func (d *Device) CondensationRisk(surfaceTemp float32) bool {
+	dew, ok := d.DewPoint()
+	return ok && dew >= surfaceTemp
+}
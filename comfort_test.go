@@ -0,0 +1,28 @@
+package netatmo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAbsoluteHumidity(t *testing.T) {
+	// Reference values for saturation over water
+	tests := []struct {
+		tempC, humidity float32
+		want            float64 // g/m³
+	}{
+		{20, 50, 8.65},
+		{20, 100, 17.3},
+		{30, 80, 24.3},
+		{0, 100, 4.85},
+		{-10, 100, 2.36},
+		{-10, 50, 1.18},
+		{25, 0, 0},
+	}
+	for _, tt := range tests {
+		got := AbsoluteHumidity(tt.tempC, tt.humidity)
+		if math.Abs(float64(got)-tt.want) > 0.05 {
+			t.Errorf("AbsoluteHumidity(%g, %g) = %.3f, want %.2f", tt.tempC, tt.humidity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package netatmo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// PreferredSource returns the module of station d that should be used for
+// metric (a Data() key): the outdoor module for temperature and humidity,
+// the rain and wind gauges for their measures, and the base station for CO2,
+// noise and pressure, which only it measures. ok is false if the station has
+// no such module.
+func (d *Device) PreferredSource(metric string) (*Device, bool) {
+	var typ string
+	switch metric {
+	case "Temperature", "MinTemp", "MaxTemp", "TempTrend", "Humidity":
+		typ = TypeOutdoor
+	case "Rain", "Rain1Hour", "Rain1Day":
+		typ = TypeRain
+	case "WindAngle", "WindStrength", "GustAngle", "GustStrength":
+		typ = TypeWind
+	case "CO2", "Noise", "Pressure", "AbsolutePressure", "PressureTrend":
+		typ = TypeStation
+	default:
+		return nil, false
+	}
+	for _, m := range d.Modules() {
+		if m.Type == typ {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Formatted returns the values of Data() as display strings following the
+// conventions of the Netatmo app, e.g. "21.3 °C", "1380 ppm" or
+// "1013.2 mbar". CO2 is rounded to the nearest 10 ppm. With WithUserUnits,
+// values are converted to the units preferred by the account. The map is
+// empty if d has no measure, e.g. an unreachable module.
+func (d *Device) Formatted() map[string]string {
+	if d.DashboardData.LastMeasure == nil {
+		return map[string]string{}
+	}
+	_, data := d.Data()
+	m := make(map[string]string, len(data))
+	for k, v := range data {
+		m[k] = formatMetric(k, v, d.units)
+	}
+	return m
+}
+
+// formatMetric formats a single Data() value for display in units.
+func formatMetric(metric string, v interface{}, units UserPreferences) string {
+	f, ok := toFloat32(v)
+	if !ok {
+		return formatValue(v)
+	}
+	if format, ok := units.format(metric); ok {
+		return fmt.Sprintf(format, units.convert(metric, f))
+	}
+	switch metric {
+	case "Humidity":
+		return fmt.Sprintf("%.0f %%", f)
+	case "CO2":
+		return fmt.Sprintf("%.0f ppm", math.Round(float64(f)/10)*10)
+	case "Noise":
+		return fmt.Sprintf("%.0f dB", f)
+	case "WindAngle", "GustAngle":
+		return fmt.Sprintf("%.0f°", f)
+	}
+	return fmt.Sprint(v)
+}
+
+// unixTime converts a unix timestamp in seconds to a UTC time.Time. ok is
+// false, and the zero time returned, if ts is nil or 0, which the API sends
+// for unset dates.
+func unixTime(ts *int64) (time.Time, bool) {
+	if ts == nil || *ts == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(*ts, 0).UTC(), true
+}
+
+// MeasureTime returns the time of the last measure.
+func (dd DashboardData) MeasureTime() (time.Time, bool) {
+	return unixTime(dd.LastMeasure)
+}
+
+// MaxTempTime returns when today's maximum temperature was reached.
+func (dd DashboardData) MaxTempTime() (time.Time, bool) {
+	return unixTime(dd.DateMaxTemp)
+}
+
+// MinTempTime returns when today's minimum temperature was reached.
+func (dd DashboardData) MinTempTime() (time.Time, bool) {
+	return unixTime(dd.DateMinTemp)
+}
+
+// SetupTime returns when the device was first set up.
+func (d *Device) SetupTime() (time.Time, bool) {
+	return unixTime(d.DateSetup)
+}
+
+// LastSetupTime returns when the device was last set up.
+func (d *Device) LastSetupTime() (time.Time, bool) {
+	return unixTime(d.LastSetup)
+}
+
+// LastMessageTime returns when the module last communicated with its station.
+func (d *Device) LastMessageTime() (time.Time, bool) {
+	return unixTime(d.LastMessage)
+}
+
+// LastStatusStoreTime returns when the station last sent data to Netatmo.
+func (d *Device) LastStatusStoreTime() (time.Time, bool) {
+	return unixTime(d.LastStatusStore)
+}
+
+// LastSeen returns the latest time d was heard of: its last message, status
+// upload or measure.
+func (d *Device) LastSeen() (time.Time, bool) {
+	var latest time.Time
+	found := false
+	for _, get := range []func() (time.Time, bool){d.LastMessageTime, d.LastStatusStoreTime, d.DashboardData.MeasureTime} {
+		if t, ok := get(); ok && (!found || t.After(latest)) {
+			latest, found = t, true
+		}
+	}
+	return latest, found
+}
+
+// offlineAfter is how long a device may stay silent before it is shown as
+// offline.
+const offlineAfter = 24 * time.Hour
+
+// LastSeenHumanized describes how long ago d was last seen, e.g. "just
+// now", "5 minutes ago" or "2 hours ago". It is "offline" if Netatmo
+// reports d unreachable, or it was not seen for a day.
+func (d *Device) LastSeenHumanized() string {
+	t, ok := d.LastSeen()
+	age := time.Since(t)
+	if !ok || (d.Reachable != nil && !*d.Reachable) || age >= offlineAfter {
+		return "offline"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit + " ago"
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute")
+	}
+	return plural(int(age/time.Hour), "hour")
+}
+
+// TrendReliable reports whether the trends and daily min/max of d can be
+// trusted. They are meaningless for about a day after the device is set up
+// or moved, so TrendReliable returns false within 24h of its last setup.
+func (d *Device) TrendReliable() bool {
+	setup, ok := d.LastSetupTime()
+	if !ok {
+		if setup, ok = d.SetupTime(); !ok {
+			return true
+		}
+	}
+	return time.Since(setup) >= 24*time.Hour
+}
+
+// typeOrder gives the display rank of each module type.
+var typeOrder = map[string]int{
+	TypeStation: 0,
+	TypeOutdoor: 1,
+	TypeIndoor:  2,
+	TypeRain:    3,
+	TypeWind:    4,
+}
+
+// ModulesSorted returns the same devices as Modules in a stable order: base
+// station, outdoor, indoor, rain and wind modules, then unknown types.
+// Modules of the same type are ordered by ID.
+func (d *Device) ModulesSorted() []*Device {
+	list := d.Modules()
+	rank := func(m *Device) int {
+		if r, ok := typeOrder[m.Type]; ok {
+			return r
+		}
+		return len(typeOrder)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if ri, rj := rank(list[i]), rank(list[j]); ri != rj {
+			return ri < rj
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Coordinates returns the latitude and longitude of the device's place. ok
+// is false if either is missing.
+func (d *Device) Coordinates() (lat, lon float32, ok bool) {
+	loc := d.Place.Location
+	if loc.Latitude == nil || loc.Longitude == nil {
+		return 0, 0, false
+	}
+	return *loc.Latitude, *loc.Longitude, true
+}
+
+// IndoorModules returns the base station d, which measures indoors too,
+// followed by its additional indoor modules.
+func (d *Device) IndoorModules() []*Device {
+	list := []*Device{d}
+	for _, m := range d.linked() {
+		if m.Type == TypeIndoor {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// ProjectedRead is like Read but returns a copy of the collection in which
+// the dashboard data only keeps the given fields, named as in Data(). The
+// measure timestamp is always kept. Use it to cache lightweight snapshots.
+func (c *Client) ProjectedRead(fields ...string) (*DeviceCollection, error) {
+	dc, _, err := c.Read()
+	if err != nil {
+		return nil, err
+	}
+	projected := &DeviceCollection{}
+	projected.Body.User = dc.Body.User
+	for _, station := range dc.Stations() {
+		projected.Body.Devices = append(projected.Body.Devices, station.project(fields))
+	}
+	return projected, nil
+}
+
+// project returns a copy of d and its modules keeping only the given
+// dashboard data fields.
+func (d *Device) project(fields []string) *Device {
+	p := *d
+	p.DashboardData = d.DashboardData.project(fields)
+	p.LinkedModules = nil
+	for _, m := range d.linked() {
+		p.LinkedModules = append(p.LinkedModules, m.project(fields))
+	}
+	return &p
+}
+
+// project returns a copy of dd keeping only the given fields.
+func (dd DashboardData) project(fields []string) DashboardData {
+	p := DashboardData{LastMeasure: dd.LastMeasure}
+	for _, f := range fields {
+		switch f {
+		case "Temperature":
+			p.Temperature = dd.Temperature
+		case "MinTemp":
+			p.MinTemp, p.DateMinTemp = dd.MinTemp, dd.DateMinTemp
+		case "MaxTemp":
+			p.MaxTemp, p.DateMaxTemp = dd.MaxTemp, dd.DateMaxTemp
+		case "DateMinTemp":
+			p.DateMinTemp = dd.DateMinTemp
+		case "DateMaxTemp":
+			p.DateMaxTemp = dd.DateMaxTemp
+		case "TempTrend":
+			p.TempTrend = dd.TempTrend
+		case "Humidity":
+			p.Humidity = dd.Humidity
+		case "CO2":
+			p.CO2 = dd.CO2
+		case "Noise":
+			p.Noise = dd.Noise
+		case "Pressure":
+			p.Pressure = dd.Pressure
+		case "AbsolutePressure":
+			p.AbsolutePressure = dd.AbsolutePressure
+		case "PressureTrend":
+			p.PressureTrend = dd.PressureTrend
+		case "Rain":
+			p.Rain = dd.Rain
+		case "Rain1Hour":
+			p.Rain1Hour = dd.Rain1Hour
+		case "Rain1Day":
+			p.Rain1Day = dd.Rain1Day
+		case "WindAngle":
+			p.WindAngle = dd.WindAngle
+		case "WindStrength":
+			p.WindStrength = dd.WindStrength
+		case "GustAngle":
+			p.GustAngle = dd.GustAngle
+		case "GustStrength":
+			p.GustStrength = dd.GustStrength
+		}
+	}
+	return p
+}
+
+// MostRecentMeasure returns the time of the newest measure among station d
+// and its modules.
+func (d *Device) MostRecentMeasure() (time.Time, bool) {
+	var latest time.Time
+	found := false
+	for _, m := range d.Modules() {
+		if t, ok := m.DashboardData.MeasureTime(); ok && (!found || t.After(latest)) {
+			latest, found = t, true
+		}
+	}
+	return latest, found
+}
+
+// FreshestStation returns the station whose most recent measure, among its
+// own and its modules', is the newest, e.g. to fail over between redundant
+// stations at one site. ok is false if no station has any measure.
+func (dc *DeviceCollection) FreshestStation() (*Device, bool) {
+	var freshest *Device
+	var latest time.Time
+	for _, station := range dc.Stations() {
+		if t, ok := station.MostRecentMeasure(); ok && (freshest == nil || t.After(latest)) {
+			freshest, latest = station, t
+		}
+	}
+	return freshest, freshest != nil
+}
+
+// DisplayName returns the best label for d: its module name, else its
+// station name, else its ID.
+func (d *Device) DisplayName() string {
+	switch {
+	case d.ModuleName != "":
+		return d.ModuleName
+	case d.StationName != "":
+		return d.StationName
+	}
+	return d.ID
+}
+
+// Capability is a kind of measure a module can take.
+type Capability int
+
+// Capabilities of Netatmo weather modules.
+const (
+	CapTemperature Capability = iota
+	CapHumidity
+	CapCO2
+	CapNoise
+	CapPressure
+	CapRain
+	CapWind
+)
+
+var capabilityNames = [...]string{"temperature", "humidity", "co2", "noise", "pressure", "rain", "wind"}
+
+func (c Capability) String() string {
+	if c < 0 || int(c) >= len(capabilityNames) {
+		return "unknown"
+	}
+	return capabilityNames[c]
+}
+
+// typeCapabilities lists what each module type measures.
+var typeCapabilities = map[string][]Capability{
+	TypeStation: {CapTemperature, CapHumidity, CapCO2, CapNoise, CapPressure},
+	TypeOutdoor: {CapTemperature, CapHumidity},
+	TypeWind:    {CapWind},
+	TypeRain:    {CapRain},
+	TypeIndoor:  {CapTemperature, CapHumidity, CapCO2},
+}
+
+// Capabilities returns what d measures, according to its type and to the
+// values present in its dashboard data, in Capability order.
+func (d *Device) Capabilities() []Capability {
+	var has [len(capabilityNames)]bool
+	for _, c := range typeCapabilities[d.Type] {
+		has[c] = true
+	}
+	dd := d.DashboardData
+	has[CapTemperature] = has[CapTemperature] || dd.Temperature != nil
+	has[CapHumidity] = has[CapHumidity] || dd.Humidity != nil
+	has[CapCO2] = has[CapCO2] || dd.CO2 != nil
+	has[CapNoise] = has[CapNoise] || dd.Noise != nil
+	has[CapPressure] = has[CapPressure] || dd.Pressure != nil || dd.AbsolutePressure != nil
+	has[CapRain] = has[CapRain] || dd.Rain != nil
+	has[CapWind] = has[CapWind] || dd.WindStrength != nil || dd.GustStrength != nil
+
+	var caps []Capability
+	for c, ok := range has {
+		if ok {
+			caps = append(caps, Capability(c))
+		}
+	}
+	return caps
+}
+
+// SignalQuality is a product independent rating of a radio or wifi signal.
+type SignalQuality int
+
+// Signal qualities, from worst to best.
+const (
+	SignalUnknown SignalQuality = iota
+	SignalLow
+	SignalMedium
+	SignalHigh
+	SignalFull
+)
+
+var signalNames = [...]string{"unknown", "low", "medium", "high", "full"}
+
+func (q SignalQuality) String() string {
+	if q < 0 || int(q) >= len(signalNames) {
+		return "unknown"
+	}
+	return signalNames[q]
+}
+
+// WifiQuality rates a Netatmo wifi signal level, such as wifi_status or the
+// wifi_strength of Energy devices. Lower levels are better.
+func WifiQuality(level int32) SignalQuality {
+	switch {
+	case level >= 86:
+		return SignalLow
+	case level >= 71:
+		return SignalMedium
+	case level >= 56:
+		return SignalHigh
+	}
+	return SignalFull
+}
+
+// RFQuality rates a Netatmo radio signal level, such as rf_status or the
+// rf_strength of Energy devices. Lower levels are better.
+func RFQuality(level int32) SignalQuality {
+	switch {
+	case level >= 90:
+		return SignalLow
+	case level >= 80:
+		return SignalMedium
+	case level >= 70:
+		return SignalHigh
+	}
+	return SignalFull
+}
+
+// SignalQuality rates the connection of d: the wifi signal of a base
+// station, the radio signal of a module.
+func (d *Device) SignalQuality() SignalQuality {
+	switch {
+	case d.WifiStatus != nil:
+		return WifiQuality(*d.WifiStatus)
+	case d.RFStatus != nil:
+		return RFQuality(*d.RFStatus)
+	}
+	return SignalUnknown
+}
+
+// BatteryStatus is a product independent rating of a module battery.
+type BatteryStatus int
+
+// Battery statuses, from worst to best.
+const (
+	BatteryUnknown BatteryStatus = iota
+	BatteryVeryLow
+	BatteryLow
+	BatteryMedium
+	BatteryHigh
+	BatteryFull
+)
+
+var batteryNames = [...]string{"unknown", "very low", "low", "medium", "high", "full"}
+
+func (b BatteryStatus) String() string {
+	if b < 0 || int(b) >= len(batteryNames) {
+		return "unknown"
+	}
+	return batteryNames[b]
+}
+
+// batteryThresholds are the lowest battery_vp, in mV, of the low, medium,
+// high and full statuses of each module type, as documented by Netatmo.
+var batteryThresholds = map[string][4]int32{
+	TypeOutdoor: {4000, 4500, 5000, 5500},
+	TypeWind:    {4360, 4770, 5180, 5590},
+	TypeRain:    {4000, 4500, 5000, 5500},
+	TypeIndoor:  {4560, 4920, 5280, 5640},
+}
+
+// BatteryStatus rates the battery of module d from its voltage using the
+// thresholds of its type, or else from its battery percentage. It is
+// BatteryUnknown for base stations, which are mains powered.
+func (d *Device) BatteryStatus() BatteryStatus {
+	if limits, ok := batteryThresholds[d.Type]; ok && d.BatteryVP != nil {
+		status := BatteryVeryLow
+		for _, limit := range limits {
+			if *d.BatteryVP >= limit {
+				status++
+			}
+		}
+		return status
+	}
+	if d.BatteryPercent == nil {
+		return BatteryUnknown
+	}
+	switch p := *d.BatteryPercent; {
+	case p >= 75:
+		return BatteryFull
+	case p >= 50:
+		return BatteryHigh
+	case p >= 25:
+		return BatteryMedium
+	case p >= 10:
+		return BatteryLow
+	}
+	return BatteryVeryLow
+}
+
+// LowBatteryModules returns the modules of all stations whose battery
+// status is at or below level, e.g. BatteryLow for a list of batteries to
+// replace soon. Modules of unknown status are left out.
+func (dc *DeviceCollection) LowBatteryModules(level BatteryStatus) []*Device {
+	var low []*Device
+	for _, station := range dc.Stations() {
+		for _, module := range station.linked() {
+			if status := module.BatteryStatus(); status != BatteryUnknown && status <= level {
+				low = append(low, module)
+			}
+		}
+	}
+	return low
+}
+
+// Pressures returns both the sea level and the absolute pressure of d in
+// hPa. If only one is reported, the other is derived from it using the
+// altitude of the station and the standard atmosphere. ok is false if
+// neither is available, or the altitude is needed but unknown.
+func (d *Device) Pressures() (sealevel, absolute float32, ok bool) {
+	dd := d.DashboardData
+	if dd.Pressure != nil && dd.AbsolutePressure != nil {
+		return *dd.Pressure, *dd.AbsolutePressure, true
+	}
+	if d.Place.Altitude == nil || (dd.Pressure == nil && dd.AbsolutePressure == nil) {
+		return 0, 0, false
+	}
+	// Ratio of absolute to sea level pressure at the station's altitude
+	ratio := float32(math.Pow(1-float64(*d.Place.Altitude)/44330, 5.255))
+	if dd.Pressure != nil {
+		return *dd.Pressure, *dd.Pressure * ratio, true
+	}
+	return *dd.AbsolutePressure / ratio, *dd.AbsolutePressure, true
+}
+
+// TimeZone returns the time zone of the station's place, e.g. to build
+// measure query bounds at local midnight or to display measures locally.
+func (d *Device) TimeZone() (*time.Location, error) {
+	if d.Place.Timezone == "" {
+		return nil, fmt.Errorf("no time zone for device %s", d.ID)
+	}
+	return time.LoadLocation(d.Place.Timezone)
+}
+
+// tempRange returns today's temperature range of d.
+func (d *Device) tempRange() (float32, bool) {
+	dd := d.DashboardData
+	if dd.MinTemp == nil || dd.MaxTemp == nil {
+		return 0, false
+	}
+	return *dd.MaxTemp - *dd.MinTemp, true
+}
+
+// LikelyMisconfigured applies heuristics to station d to detect a common
+// setup mistake: the outdoor module placed indoors, or swapped with the base
+// station. It returns a hint describing the suspicion. The checks rely on
+// today's min/max, so they are only meaningful late in the day.
+func (d *Device) LikelyMisconfigured() (bool, string) {
+	var outdoor *Device
+	for _, m := range d.linked() {
+		if m.Type == TypeOutdoor {
+			outdoor = m
+			break
+		}
+	}
+	if outdoor == nil || outdoor.DashboardData.Temperature == nil {
+		return false, ""
+	}
+
+	outRange, okOut := outdoor.tempRange()
+	inRange, okIn := d.tempRange()
+	if okOut && okIn && outRange < 1 && inRange > 8 {
+		return true, fmt.Sprintf("%s varies like an outdoor sensor and %s like an indoor one; are they swapped?",
+			d.DisplayName(), outdoor.DisplayName())
+	}
+	if t := *outdoor.DashboardData.Temperature; okOut && outRange < 1 && t >= 19 && t <= 24 {
+		return true, fmt.Sprintf("%s reads a steady %.1f °C; is the outdoor module placed indoors?",
+			outdoor.DisplayName(), t)
+	}
+	return false, ""
+}
+
+// clockSkewTolerance is how far in the future a measure may lie before the
+// clocks are considered out of sync.
+const clockSkewTolerance = time.Minute
+
+// ClockSkew returns how far the last measure of d lies in the future of the
+// local clock. A positive value means the local clock or Netatmo's is off;
+// the normal age of a measure gives a negative value. It is 0 if d has no
+// measure.
+func (d *Device) ClockSkew() time.Duration {
+	t, ok := d.DashboardData.MeasureTime()
+	if !ok {
+		return 0
+	}
+	return time.Until(t)
+}
+
+// IsStale reports whether the last measure of d is older than maxAge. A
+// device without measure is stale, and so is one whose measure lies in the
+// future beyond a small tolerance, since its freshness cannot be trusted.
+func (d *Device) IsStale(maxAge time.Duration) bool {
+	if _, ok := d.DashboardData.MeasureTime(); !ok {
+		return true
+	}
+	skew := d.ClockSkew()
+	if skew > clockSkewTolerance {
+		return true
+	}
+	return -skew > maxAge
+}
+
+// DefaultRainThreshold is the rain below which RainSignificant reports no
+// rain, in mm. It is one tip of the rain gauge's bucket, about 0.1 mm.
+const DefaultRainThreshold float32 = 0.101
+
+// RainSignificant returns the rain of the last measure interval in mm, or 0
+// if it is below threshold, so that sensor jitter is not taken for rain.
+// A threshold <= 0 selects DefaultRainThreshold. ok is false if d measures
+// no rain.
+func (d *Device) RainSignificant(threshold float32) (float32, bool) {
+	if d.DashboardData.Rain == nil {
+		return 0, false
+	}
+	if threshold <= 0 {
+		threshold = DefaultRainThreshold
+	}
+	if rain := *d.DashboardData.Rain; rain >= threshold {
+		return rain, true
+	}
+	return 0, true
+}
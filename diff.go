@@ -0,0 +1,72 @@
+package netatmo
+
+import "sort"
+
+// FieldChange is a change of one sensor value of a module between two
+// collections. Old or New is nil if the value is missing on that side.
+type FieldChange struct {
+	ModuleID   string
+	ModuleName string
+	Metric     string // key as returned by Data()
+	Old        interface{}
+	New        interface{}
+}
+
+// Diff returns the sensor values that differ from dc to other, typically
+// the previous and the latest poll. Modules appearing or disappearing
+// produce changes for all their values.
+func (dc *DeviceCollection) Diff(other *DeviceCollection) []FieldChange {
+	oldData := moduleData(dc)
+	newData := moduleData(other)
+
+	var changes []FieldChange
+	compare := func(m *Device, before, after map[string]interface{}) {
+		keys := make(map[string]bool)
+		for k := range before {
+			keys[k] = true
+		}
+		for k := range after {
+			keys[k] = true
+		}
+		metrics := make([]string, 0, len(keys))
+		for k := range keys {
+			metrics = append(metrics, k)
+		}
+		sort.Strings(metrics)
+		for _, metric := range metrics {
+			o, n := before[metric], after[metric]
+			if o != n {
+				changes = append(changes, FieldChange{
+					ModuleID:   m.ID,
+					ModuleName: m.ModuleName,
+					Metric:     metric,
+					Old:        o,
+					New:        n,
+				})
+			}
+		}
+	}
+
+	other.Walk(func(_, m *Device) {
+		compare(m, oldData[m.ID], newData[m.ID])
+	})
+	dc.Walk(func(_, m *Device) {
+		if _, ok := newData[m.ID]; !ok {
+			compare(m, oldData[m.ID], nil)
+		}
+	})
+	return changes
+}
+
+// moduleData returns the Data() values of every module by module ID.
+func moduleData(dc *DeviceCollection) map[string]map[string]interface{} {
+	data := make(map[string]map[string]interface{})
+	dc.Walk(func(_, m *Device) {
+		if m.DashboardData.LastMeasure == nil {
+			data[m.ID] = nil
+			return
+		}
+		_, data[m.ID] = m.Data()
+	})
+	return data
+}
@@ -0,0 +1,185 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Default cache lifetimes of the Energy endpoints: the home topology rarely
+// changes while its status does.
+const (
+	defaultHomesDataTTL  = time.Hour
+	defaultHomeStatusTTL = 0
+)
+
+// ttlCache caches raw response bodies for a fixed duration.
+type ttlCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]ttlEntry
+}
+
+type ttlEntry struct {
+	body    json.RawMessage
+	expires time.Time
+}
+
+// get returns the cached body for key, calling fetch if it is missing or
+// expired.
+func (tc *ttlCache) get(key string, fetch func() (json.RawMessage, error)) (json.RawMessage, error) {
+	tc.mu.Lock()
+	e, ok := tc.entries[key]
+	tc.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.body, nil
+	}
+
+	body, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if tc.ttl > 0 {
+		tc.mu.Lock()
+		if tc.entries == nil {
+			tc.entries = make(map[string]ttlEntry)
+		}
+		tc.entries[key] = ttlEntry{body: body, expires: time.Now().Add(tc.ttl)}
+		tc.mu.Unlock()
+	}
+	return body, nil
+}
+
+// GetHomesData retrieves the topology of the user's Energy homes (homes,
+// rooms and modules) as the raw "body" of the homesdata response. Results
+// are cached for an hour by default, see WithHomesDataTTL.
+func (c *Client) GetHomesData(ctx context.Context) (json.RawMessage, error) {
+	return c.homesData.get("", func() (json.RawMessage, error) {
+		return c.getBody(ctx, homesDataPath, nil)
+	})
+}
+
+// GetHomeStatus retrieves the current status of an Energy home as the raw
+// "body" of the homestatus response. Results are not cached by default, see
+// WithHomeStatusTTL.
+func (c *Client) GetHomeStatus(ctx context.Context, homeID string) (json.RawMessage, error) {
+	return c.homeStatus.get(homeID, func() (json.RawMessage, error) {
+		return c.getBody(ctx, homeStatusPath, url.Values{"home_id": {homeID}})
+	})
+}
+
+// HomeStatusModule is the status of a module of an Energy home, as listed by
+// homestatus. Only the fields shared across product lines are decoded; see
+// GetHomeStatus for the others.
+type HomeStatusModule struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Bridge       string `json:"bridge,omitempty"` // ID of the gateway of the module, if any
+	Reachable    *bool  `json:"reachable,omitempty"`
+	RFStrength   *int32 `json:"rf_strength,omitempty"`
+	WifiStrength *int32 `json:"wifi_strength,omitempty"`
+}
+
+// SignalQuality rates the connection of m: its wifi signal if it has one,
+// else its radio signal.
+func (m *HomeStatusModule) SignalQuality() SignalQuality {
+	switch {
+	case m.WifiStrength != nil:
+		return WifiQuality(*m.WifiStrength)
+	case m.RFStrength != nil:
+		return RFQuality(*m.RFStrength)
+	}
+	return SignalUnknown
+}
+
+// GetHomeStatusModules retrieves the status of the modules of an Energy
+// home, decoded from GetHomeStatus and sharing its cache.
+func (c *Client) GetHomeStatusModules(ctx context.Context, homeID string) ([]HomeStatusModule, error) {
+	body, err := c.GetHomeStatus(ctx, homeID)
+	if err != nil {
+		return nil, err
+	}
+	var status struct {
+		Home struct {
+			Modules []HomeStatusModule `json:"modules"`
+		} `json:"home"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode home status: %w", err)
+	}
+	return status.Home.Modules, nil
+}
+
+// getBody calls an endpoint and returns the "body" of its response.
+func (c *Client) getBody(ctx context.Context, endpoint string, data url.Values) (json.RawMessage, error) {
+	var holder struct {
+		Body json.RawMessage `json:"body"`
+	}
+	resp, err := c.doHTTPGet(ctx, c.baseURL+endpoint, data)
+	if _, err := processHTTPResponse(resp, err, &holder); err != nil {
+		return nil, err
+	}
+	return holder.Body, nil
+}
+
+// SetStateHome is the state to apply to an Energy home with SetState. Only
+// the rooms and modules listed are changed.
+type SetStateHome struct {
+	ID      string           `json:"id"`
+	Rooms   []SetStateRoom   `json:"rooms,omitempty"`
+	Modules []SetStateModule `json:"modules,omitempty"`
+}
+
+// SetStateRoom is the heating state to apply to a room.
+type SetStateRoom struct {
+	ID                       string   `json:"id"`
+	ThermSetpointMode        string   `json:"therm_setpoint_mode,omitempty"` // "manual", "max" or "home"
+	ThermSetpointTemperature *float64 `json:"therm_setpoint_temperature,omitempty"`
+	ThermSetpointEndTime     int64    `json:"therm_setpoint_end_time,omitempty"` // unix timestamp
+}
+
+// SetStateModule is the state to apply to a module. State holds its
+// product specific fields, e.g. {"on": true} or {"target_position": 100},
+// which are sent alongside id and bridge.
+type SetStateModule struct {
+	ID     string
+	Bridge string // ID of the gateway of the module, if any
+	State  map[string]interface{}
+}
+
+// MarshalJSON encodes the module as a single object with its State fields.
+func (m SetStateModule) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]interface{}, len(m.State)+2)
+	for k, v := range m.State {
+		obj[k] = v
+	}
+	obj["id"] = m.ID
+	if m.Bridge != "" {
+		obj["bridge"] = m.Bridge
+	}
+	return json.Marshal(obj)
+}
+
+// SetState changes the state of rooms and modules of an Energy home, e.g.
+// thermostat setpoints, valves or shutters. Cached GetHomeStatus results
+// are dropped.
+func (c *Client) SetState(ctx context.Context, home SetStateHome) error {
+	body := struct {
+		Home SetStateHome `json:"home"`
+	}{home}
+	var holder struct {
+		Status string `json:"status"`
+	}
+	resp, err := c.doHTTPPostJSON(ctx, c.baseURL+setStatePath, body)
+	if _, err := processHTTPResponse(resp, err, &holder); err != nil {
+		return err
+	}
+	c.homeStatus.mu.Lock()
+	delete(c.homeStatus.entries, home.ID)
+	c.homeStatus.mu.Unlock()
+	return nil
+}
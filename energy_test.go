@@ -0,0 +1,45 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetHomeStatusModules(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":{"home":{"id":"home","modules":[
+			{"id":"relay","type":"NAPlug","reachable":true,"wifi_strength":60},
+			{"id":"valve","type":"NRV","bridge":"relay","reachable":false,"rf_strength":95},
+			{"id":"other","type":"NLG"}
+		]}},"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClientWithCredentials("id", "secret", "token", "refresh", time.Now().Add(time.Hour), WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, err := c.GetHomeStatusModules(context.Background(), "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 3 {
+		t.Fatalf("GetHomeStatusModules returned %d modules, want 3", len(modules))
+	}
+	want := []SignalQuality{SignalHigh, SignalLow, SignalUnknown}
+	for i, m := range modules {
+		if q := m.SignalQuality(); q != want[i] {
+			t.Errorf("module %s signal %v, want %v", m.ID, q, want[i])
+		}
+	}
+	if r := modules[1].Reachable; r == nil || *r {
+		t.Errorf("valve reachable = %v, want false", r)
+	}
+	if modules[1].Bridge != "relay" {
+		t.Errorf("valve bridge %q, want relay", modules[1].Bridge)
+	}
+}
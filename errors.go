@@ -0,0 +1,145 @@
+package netatmo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"golang.org/x/oauth2"
+)
+
+// AuthError is returned when the OAuth2 token could not be refreshed, e.g.
+// because the refresh token has been revoked.
+type AuthError struct {
+	Code        string // OAuth2 error code, such as "invalid_grant"
+	Description string
+	Err         error
+}
+
+func (e *AuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("netatmo auth error: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("netatmo auth error: %s", e.Code)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// asAuthError converts a token refresh failure found in err into an
+// *AuthError. Other errors are returned unchanged.
+func asAuthError(err error) error {
+	var rerr *oauth2.RetrieveError
+	if !errors.As(err, &rerr) {
+		return err
+	}
+	code := rerr.ErrorCode
+	if code == "" && rerr.Response != nil {
+		code = fmt.Sprintf("http %d", rerr.Response.StatusCode)
+	}
+	return &AuthError{Code: code, Description: rerr.ErrorDescription, Err: rerr}
+}
+
+// ErrReauthRequired is returned when the access token has expired and the
+// config has no refresh token to renew it. A new token must be generated on
+// the Netatmo developer site.
+var ErrReauthRequired = errors.New("netatmo: token expired and no refresh token, re-authorization required")
+
+// ErrorCode is a Netatmo API error code.
+type ErrorCode int
+
+// Error codes documented by Netatmo.
+const (
+	ErrCodeUnknown             ErrorCode = 1
+	ErrCodeInvalidAccessToken  ErrorCode = 2
+	ErrCodeAccessTokenExpired  ErrorCode = 3
+	ErrCodeInternal            ErrorCode = 4
+	ErrCodeApplicationDisabled ErrorCode = 5
+	ErrCodeNotFound            ErrorCode = 7
+	ErrCodeDeviceNotFound      ErrorCode = 9
+	ErrCodeMissingArgs         ErrorCode = 10
+	ErrCodeOperationForbidden  ErrorCode = 13
+	ErrCodeInvalidArgument     ErrorCode = 21
+	ErrCodeApplicationNotFound ErrorCode = 22
+	ErrCodeUserNotFound        ErrorCode = 23
+	ErrCodeInvalidDate         ErrorCode = 25
+	ErrCodeMaximumUsageReached ErrorCode = 26
+	ErrCodeInvalidRefreshToken ErrorCode = 30
+)
+
+// APIError is an error returned by the Netatmo API.
+type APIError struct {
+	StatusCode int // HTTP status
+	Code       ErrorCode
+	Message    string
+
+	// RequiredScope is the OAuth2 scope needed by the endpoint, if known.
+	RequiredScope string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("netatmo API error %d (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+	if e.IsInsufficientScope() && e.RequiredScope != "" {
+		msg += fmt.Sprintf(" (token may be missing the %s scope; reauthorize with this scope)", e.RequiredScope)
+	}
+	return msg
+}
+
+// IsInsufficientScope reports whether the token lacks the scope needed by
+// the endpoint.
+func (e *APIError) IsInsufficientScope() bool {
+	return e.Code == ErrCodeOperationForbidden && e.StatusCode == http.StatusForbidden
+}
+
+// IsRateLimited reports whether the request was rejected because the usage
+// limit of the application was reached.
+func (e *APIError) IsRateLimited() bool {
+	return e.Code == ErrCodeMaximumUsageReached || e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsTokenExpired reports whether the access token has expired.
+func (e *APIError) IsTokenExpired() bool {
+	return e.Code == ErrCodeAccessTokenExpired
+}
+
+// IsInvalidToken reports whether the access or refresh token is invalid.
+func (e *APIError) IsInvalidToken() bool {
+	return e.Code == ErrCodeInvalidAccessToken || e.Code == ErrCodeInvalidRefreshToken
+}
+
+// IsDeviceNotFound reports whether the requested device does not exist or
+// is not accessible to the user.
+func (e *APIError) IsDeviceNotFound() bool {
+	return e.Code == ErrCodeDeviceNotFound
+}
+
+// requiredScopes maps endpoint names to the scope they need.
+var requiredScopes = map[string]string{
+	path.Base(devicePath):     "read_station",
+	path.Base(measurePath):    "read_station",
+	path.Base(publicDataPath): "read_station",
+	path.Base(homesDataPath):  "read_thermostat",
+	path.Base(homeStatusPath): "read_thermostat",
+}
+
+// parseAPIError decodes the error body of a failed API response. It returns
+// nil if data is not a Netatmo error.
+func parseAPIError(resp *http.Response, data []byte) *APIError {
+	var holder struct {
+		Error *struct {
+			Code    ErrorCode `json:"code"`
+			Message string    `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &holder) != nil || holder.Error == nil {
+		return nil
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Code: holder.Error.Code, Message: holder.Error.Message}
+	if resp.Request != nil {
+		apiErr.RequiredScope = requiredScopes[path.Base(resp.Request.URL.Path)]
+	}
+	return apiErr
+}
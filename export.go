@@ -0,0 +1,373 @@
+package netatmo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a single sensor value of a module, as returned by Flatten.
+type Record struct {
+	StationID   string
+	StationName string
+	ModuleID    string
+	ModuleName  string
+	ModuleType  string
+	Metric      string      // key as returned by Data(), e.g. "Temperature", unless renamed
+	Value       interface{} // float32, int32, string or time.Time
+	Time        int64       // unix timestamp of the measure
+}
+
+// ExportOption configures Flatten and the exporters built on it.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	precision int               // decimal places of floats, < 0 to keep them as is
+	names     map[string]string // exported name by Data() key
+	excluded  map[string]bool   // Data() keys left out
+}
+
+func newExportConfig(opts []ExportOption) *exportConfig {
+	cfg := &exportConfig{precision: -1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// name returns the exported name of metric.
+func (cfg *exportConfig) name(metric string) string {
+	if n, ok := cfg.names[metric]; ok {
+		return n
+	}
+	return metric
+}
+
+// WithPrecision rounds floating point values to the given number of decimal
+// places, so that float32 noise such as 1013.2999 is not exported.
+func WithPrecision(places int) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.precision = places
+	}
+}
+
+// WithMetricNames renames metrics in exports, e.g. {"Temperature": "temp_c"}.
+// Keys are the names used by Data(); metrics not in names keep them.
+func WithMetricNames(names map[string]string) ExportOption {
+	return func(cfg *exportConfig) {
+		cfg.names = names
+	}
+}
+
+// WithoutMetrics leaves the given metrics, named as in Data(), out of
+// exports.
+func WithoutMetrics(metrics ...string) ExportOption {
+	return func(cfg *exportConfig) {
+		if cfg.excluded == nil {
+			cfg.excluded = make(map[string]bool)
+		}
+		for _, m := range metrics {
+			cfg.excluded[m] = true
+		}
+	}
+}
+
+// Flatten returns one Record per sensor value of every module of every
+// station, ordered by station ID, module ID and metric, so that exports are
+// reproducible. Modules without measures are skipped.
+func (dc *DeviceCollection) Flatten(opts ...ExportOption) []Record {
+	var records []Record
+	dc.eachRecord(newExportConfig(opts), func(r Record) error {
+		records = append(records, r)
+		return nil
+	})
+	return records
+}
+
+// eachRecord calls fn with the records of Flatten in order, one module at a
+// time, stopping at the first error.
+func (dc *DeviceCollection) eachRecord(cfg *exportConfig, fn func(Record) error) error {
+	stations := append([]*Device(nil), dc.Stations()...)
+	sort.SliceStable(stations, func(i, j int) bool { return stations[i].ID < stations[j].ID })
+	for _, station := range stations {
+		modules := station.Modules()
+		sort.SliceStable(modules, func(i, j int) bool { return modules[i].ID < modules[j].ID })
+		for _, module := range modules {
+			if module.DashboardData.LastMeasure == nil {
+				continue
+			}
+			ts, data := module.Data()
+			metrics := make([]string, 0, len(data))
+			for k := range data {
+				if !cfg.excluded[k] {
+					metrics = append(metrics, k)
+				}
+			}
+			sort.Slice(metrics, func(i, j int) bool { return cfg.name(metrics[i]) < cfg.name(metrics[j]) })
+			for _, metric := range metrics {
+				value := data[metric]
+				if f, ok := value.(float32); ok && cfg.precision >= 0 {
+					value = *roundFloat32(&f, cfg.precision)
+				}
+				err := fn(Record{
+					StationID:   station.ID,
+					StationName: station.StationName,
+					ModuleID:    module.ID,
+					ModuleName:  module.ModuleName,
+					ModuleType:  module.Type,
+					Metric:      cfg.name(metric),
+					Value:       value,
+					Time:        ts,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LineProtocol returns the sensor values as InfluxDB line protocol, one line
+// per module. Each line is tagged with station, module and type, plus
+// extraTags, and timestamped in nanoseconds.
+func (dc *DeviceCollection) LineProtocol(measurement string, extraTags map[string]string, opts ...ExportOption) []string {
+	var extra []string
+	for k := range extraTags {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+
+	var lines []string
+	records := dc.Flatten(opts...)
+	for start := 0; start < len(records); {
+		end := start
+		for end < len(records) && records[end].ModuleID == records[start].ModuleID {
+			end++
+		}
+		r := records[start]
+
+		var b strings.Builder
+		b.WriteString(lpEscape(measurement, ", "))
+		writeTag := func(k, v string) {
+			if v == "" {
+				return
+			}
+			b.WriteString("," + lpEscape(k, ",= ") + "=" + lpEscape(v, ",= "))
+		}
+		writeTag("station", r.StationName)
+		writeTag("module", r.ModuleName)
+		writeTag("type", r.ModuleType)
+		for _, k := range extra {
+			writeTag(k, extraTags[k])
+		}
+
+		for i, f := range records[start:end] {
+			if i == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(lpEscape(f.Metric, ",= ") + "=" + lpField(f.Value))
+		}
+		fmt.Fprintf(&b, " %d", r.Time*1e9)
+
+		lines = append(lines, b.String())
+		start = end
+	}
+	return lines
+}
+
+// WriteCSV writes the records of Flatten to w as CSV, with a header line.
+func (dc *DeviceCollection) WriteCSV(w io.Writer, opts ...ExportOption) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "station_id", "station", "module_id", "module", "type", "metric", "value"})
+	for _, r := range dc.Flatten(opts...) {
+		cw.Write([]string{
+			strconv.FormatInt(r.Time, 10),
+			r.StationID, r.StationName, r.ModuleID, r.ModuleName, r.ModuleType,
+			r.Metric, formatValue(r.Value),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNDJSON writes the records of Flatten to w as newline-delimited JSON,
+// one object per line with the keys of the WriteCSV header. Records are
+// streamed rather than collected first.
+func (dc *DeviceCollection) WriteNDJSON(w io.Writer, opts ...ExportOption) error {
+	enc := json.NewEncoder(w)
+	return dc.eachRecord(newExportConfig(opts), func(r Record) error {
+		return enc.Encode(struct {
+			Time        int64       `json:"time"`
+			StationID   string      `json:"station_id"`
+			StationName string      `json:"station"`
+			ModuleID    string      `json:"module_id"`
+			ModuleName  string      `json:"module"`
+			ModuleType  string      `json:"type"`
+			Metric      string      `json:"metric"`
+			Value       interface{} `json:"value"`
+		}{r.Time, r.StationID, r.StationName, r.ModuleID, r.ModuleName, r.ModuleType, r.Metric, r.Value})
+	})
+}
+
+// formatValue formats a Data() value without float32 conversion noise, and
+// times as RFC 3339.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// lpEscape backslash-escapes every character of chars found in s.
+func lpEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lpField formats a field value for line protocol.
+func lpField(v interface{}) string {
+	switch v := v.(type) {
+	case float32:
+		return formatValue(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i"
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10) + "i"
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	default:
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	}
+}
+
+// promMetric describes how a Data() or Info() key is exposed to Prometheus.
+type promMetric struct {
+	key  string
+	name string
+	help string
+}
+
+var promMetrics = []promMetric{
+	{"Temperature", "temperature_celsius", "Temperature in degrees Celsius."},
+	{"MinTemp", "min_temperature_celsius", "Minimum temperature of the day in degrees Celsius."},
+	{"MaxTemp", "max_temperature_celsius", "Maximum temperature of the day in degrees Celsius."},
+	{"Humidity", "humidity_percent", "Relative humidity in percent."},
+	{"CO2", "co2_ppm", "CO2 level in ppm."},
+	{"Noise", "noise_db", "Noise level in dB."},
+	{"Pressure", "pressure_hpa", "Sea level pressure in hPa."},
+	{"AbsolutePressure", "absolute_pressure_hpa", "Absolute pressure in hPa."},
+	{"Rain", "rain_mm", "Rain in the last measure interval in mm."},
+	{"Rain1Hour", "rain_1h_mm", "Rain in the last hour in mm."},
+	{"Rain1Day", "rain_24h_mm", "Rain since local midnight in mm."},
+	{"WindAngle", "wind_angle_degrees", "Wind direction in degrees."},
+	{"WindStrength", "wind_strength_kmh", "Wind speed in km/h."},
+	{"GustAngle", "gust_angle_degrees", "Gust direction in degrees."},
+	{"GustStrength", "gust_strength_kmh", "Gust speed in km/h."},
+	{"BatteryPercent", "battery_percent", "Battery level in percent."},
+	{"WifiStatus", "wifi_status", "Wifi signal quality as reported by Netatmo."},
+	{"RFStatus", "rf_status", "Radio signal quality as reported by Netatmo."},
+}
+
+// WritePrometheus writes the numeric sensor and status values of all modules
+// to w in the Prometheus text exposition format. Metric names are prefixed
+// with namespace, e.g. "netatmo_temperature_celsius".
+func (dc *DeviceCollection) WritePrometheus(w io.Writer, namespace string) error {
+	type sample struct {
+		station, module *Device
+		values          map[string]interface{}
+	}
+	var samples []sample
+	for _, station := range dc.Stations() {
+		for _, module := range station.Modules() {
+			if module.DashboardData.LastMeasure == nil {
+				continue
+			}
+			_, values := module.allValues()
+			samples = append(samples, sample{station, module, values})
+		}
+	}
+
+	ew := &errWriter{w: w}
+	for _, m := range promMetrics {
+		name := m.name
+		if namespace != "" {
+			name = namespace + "_" + name
+		}
+		header := false
+		for _, s := range samples {
+			v, ok := s.values[m.key]
+			if !ok {
+				continue
+			}
+			if !header {
+				ew.printf("# HELP %s %s\n# TYPE %s gauge\n", name, m.help, name)
+				header = true
+			}
+			ew.printf("%s{station=\"%s\",module=\"%s\",type=\"%s\"} %v\n", name,
+				promEscape(s.station.StationName), promEscape(s.module.ModuleName),
+				promEscape(s.module.Type), v)
+		}
+	}
+	return ew.err
+}
+
+// promEscape escapes a Prometheus label value.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// errWriter remembers the first write error and skips subsequent writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+// WriteDOT writes the stations and their linked modules to w as a Graphviz
+// DOT graph, each node labeled with its name and type. Stations are named
+// by StationName, as their ModuleName is the name of the indoor module.
+func (dc *DeviceCollection) WriteDOT(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph netatmo {\n\trankdir=LR;\n")
+	for _, station := range dc.Stations() {
+		name := station.StationName
+		if name == "" {
+			name = station.DisplayName()
+		}
+		ew.printf("\t%s [shape=box, label=%s];\n", strconv.Quote(station.ID),
+			strconv.Quote(name+"\n"+station.Type))
+		for _, module := range station.linked() {
+			ew.printf("\t%s [label=%s];\n", strconv.Quote(module.ID),
+				strconv.Quote(module.DisplayName()+"\n"+module.Type))
+			ew.printf("\t%s -> %s;\n", strconv.Quote(station.ID), strconv.Quote(module.ID))
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
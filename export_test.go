@@ -0,0 +1,84 @@
+package netatmo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func int32p(v int32) *int32 { return &v }
+
+// shuffledCollection returns two stations, listed and linked out of ID
+// order, each module measuring temperature, humidity and pressure.
+func shuffledCollection() *DeviceCollection {
+	device := func(id, typ string, modules ...*Device) *Device {
+		return &Device{
+			ID:   id,
+			Type: typ,
+			DashboardData: DashboardData{
+				LastMeasure: int64p(100),
+				Temperature: float32p(20),
+				Humidity:    int32p(50),
+				Pressure:    float32p(1013),
+			},
+			LinkedModules: modules,
+		}
+	}
+	b := device("b", TypeStation,
+		device("b3", TypeIndoor), device("b1", TypeOutdoor), device("b2", TypeIndoor))
+	a := device("a", TypeStation,
+		device("a2", TypeIndoor), device("a1", TypeOutdoor))
+	dc := &DeviceCollection{}
+	dc.Body.Devices = []*Device{b, a}
+	return dc
+}
+
+// recordKeys returns "station/module/metric" for each record.
+func recordKeys(records []Record) []string {
+	keys := make([]string, len(records))
+	for i, r := range records {
+		keys[i] = fmt.Sprintf("%s/%s/%s", r.StationID, r.ModuleID, r.Metric)
+	}
+	return keys
+}
+
+func TestFlattenOrder(t *testing.T) {
+	var want []string
+	for _, module := range []string{"a/a", "a/a1", "a/a2", "b/b", "b/b1", "b/b2", "b/b3"} {
+		for _, metric := range []string{"Humidity", "Pressure", "Temperature"} {
+			want = append(want, module+"/"+metric)
+		}
+	}
+	got := recordKeys(shuffledCollection().Flatten())
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Flatten order:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestFlattenOrderRenamed(t *testing.T) {
+	records := shuffledCollection().Flatten(WithMetricNames(map[string]string{
+		"Temperature": "AirTemp",
+		"Humidity":    "RelHumidity",
+	}))
+	got := recordKeys(records)
+	for i, metric := range []string{"AirTemp", "Pressure", "RelHumidity"} {
+		if want := "a/a/" + metric; got[i] != want {
+			t.Errorf("record %d is %s, want %s", i, got[i], want)
+		}
+	}
+	if n := len(records); got[n-1] != "b/b3/RelHumidity" {
+		t.Errorf("last record is %s, want b/b3/RelHumidity", got[n-1])
+	}
+}
+
+func TestWriteDOTStationName(t *testing.T) {
+	dc := &DeviceCollection{}
+	dc.Body.Devices = []*Device{{ID: "s", StationName: "Home", ModuleName: "Living room", Type: TypeStation}}
+	var buf strings.Builder
+	if err := dc.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"s" [shape=box, label="Home\nNAMain"]`; !strings.Contains(buf.String(), want) {
+		t.Errorf("WriteDOT output lacks %s:\n%s", want, buf.String())
+	}
+}
@@ -8,4 +8,5 @@ require (
 	github.com/BurntSushi/toml v1.5.0
 	github.com/joshuabeny1999/netatmo-api-go/v2 v2.0.0-20250507080719-3dd9f9d51b17
 	golang.org/x/oauth2 v0.30.0
+	golang.org/x/sync v0.14.0
 )
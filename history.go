@@ -0,0 +1,351 @@
+package netatmo
+
+import (
+	"sync"
+	"time"
+)
+
+// History keeps the most recent measures of each module so that values can
+// be aggregated over time without an external time-series database.
+type History struct {
+	size       int
+	thresholds map[string]float32 // trend thresholds per hour, by metric
+
+	mu      sync.Mutex
+	modules map[string][]historyEntry
+}
+
+// historyEntry is one measure of a module, with both Data() and Info()
+// values.
+type historyEntry struct {
+	time   time.Time
+	loc    *time.Location // time zone of the station, nil if unknown
+	values map[string]interface{}
+}
+
+// NewHistory returns a History retaining up to size measures per module.
+// A size below 1 is raised to 1.
+func NewHistory(size int) *History {
+	size = max(size, 1)
+	return &History{
+		size:       size,
+		thresholds: make(map[string]float32),
+		modules:    make(map[string][]historyEntry),
+	}
+}
+
+// Add records the current measures of all modules in dc. Measures already
+// recorded (same module and timestamp) are ignored, so Add can be called
+// after every Read.
+func (h *History) Add(dc *DeviceCollection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, station := range dc.Stations() {
+		loc, _ := station.TimeZone()
+		for _, module := range station.Modules() {
+			t, ok := unixTime(module.DashboardData.LastMeasure)
+			if !ok {
+				continue
+			}
+			_, values := module.allValues()
+			s := historyEntry{time: t, loc: loc, values: values}
+
+			list := h.modules[module.ID]
+			if n := len(list); n > 0 && !s.time.After(list[n-1].time) {
+				continue
+			}
+			list = append(list, s)
+			if len(list) > h.size {
+				list = list[len(list)-h.size:]
+			}
+			h.modules[module.ID] = list
+		}
+	}
+}
+
+// series returns the numeric values of metric for moduleID measured within
+// window of the most recent measure, oldest first. A window <= 0 selects all
+// measures.
+func (h *History) series(moduleID, metric string, window time.Duration) ([]time.Time, []float32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := h.modules[moduleID]
+	if len(list) == 0 {
+		return nil, nil
+	}
+	since := list[len(list)-1].time.Add(-window)
+
+	var times []time.Time
+	var values []float32
+	for _, s := range list {
+		if window > 0 && s.time.Before(since) {
+			continue
+		}
+		if v, ok := toFloat32(s.values[metric]); ok {
+			times = append(times, s.time)
+			values = append(values, v)
+		}
+	}
+	return times, values
+}
+
+// Average returns the mean of metric for moduleID over the measures taken
+// within window of the most recent one. The metric names are those of Data()
+// and Info().
+func (h *History) Average(moduleID, metric string, window time.Duration) (float32, bool) {
+	_, values := h.series(moduleID, metric, window)
+	if len(values) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return float32(sum / float64(len(values))), true
+}
+
+// Min returns the lowest value of metric for moduleID over window.
+func (h *History) Min(moduleID, metric string, window time.Duration) (float32, bool) {
+	_, values := h.series(moduleID, metric, window)
+	if len(values) == 0 {
+		return 0, false
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		m = min(m, v)
+	}
+	return m, true
+}
+
+// Max returns the highest value of metric for moduleID over window.
+func (h *History) Max(moduleID, metric string, window time.Duration) (float32, bool) {
+	_, values := h.series(moduleID, metric, window)
+	if len(values) == 0 {
+		return 0, false
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		m = max(m, v)
+	}
+	return m, true
+}
+
+// toFloat32 converts a numeric Data() or Info() value to float32.
+func toFloat32(v interface{}) (float32, bool) {
+	switch v := v.(type) {
+	case float32:
+		return v, true
+	case int32:
+		return float32(v), true
+	}
+	return 0, false
+}
+
+// PressureTendency returns the change of sea level pressure of moduleID in
+// hPa per hour, between the oldest and newest measures within window of the
+// most recent one. The usual barometric tendency uses a 3 hour window.
+func (h *History) PressureTendency(moduleID string, window time.Duration) (float32, bool) {
+	times, values := h.series(moduleID, "Pressure", window)
+	if len(values) < 2 {
+		return 0, false
+	}
+	return ratePerHour(times[0], values[0], times[len(times)-1], values[len(values)-1])
+}
+
+// PressureTendency returns the change of sea level pressure of moduleID in
+// hPa per hour between two snapshots of the collection.
+func PressureTendency(older, newer *DeviceCollection, moduleID string) (float32, bool) {
+	m1, ok1 := older.findModule(moduleID)
+	m2, ok2 := newer.findModule(moduleID)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	d1, d2 := m1.DashboardData, m2.DashboardData
+	t1, ok1 := unixTime(d1.LastMeasure)
+	t2, ok2 := unixTime(d2.LastMeasure)
+	if d1.Pressure == nil || d2.Pressure == nil || !ok1 || !ok2 {
+		return 0, false
+	}
+	return ratePerHour(t1, *d1.Pressure, t2, *d2.Pressure)
+}
+
+// ratePerHour returns the change from v1 at t1 to v2 at t2 per hour.
+func ratePerHour(t1 time.Time, v1 float32, t2 time.Time, v2 float32) (float32, bool) {
+	hours := t2.Sub(t1).Hours()
+	if hours <= 0 {
+		return 0, false
+	}
+	return float32(float64(v2-v1) / hours), true
+}
+
+// BatteryDaysRemaining estimates the number of days until the battery of
+// moduleID is empty, by fitting a straight line to all recorded battery
+// levels. ok is false if there are too few measures or the level is not
+// decreasing.
+func (h *History) BatteryDaysRemaining(moduleID string) (float64, bool) {
+	times, values := h.series(moduleID, "BatteryPercent", 0)
+	slope, ok := linearSlope(times, values)
+	if !ok || slope >= 0 {
+		return 0, false
+	}
+	perDay := slope * 24
+	return float64(values[len(values)-1]) / -perDay, true
+}
+
+// linearSlope returns the least squares slope of values over times, per hour.
+func linearSlope(times []time.Time, values []float32) (float64, bool) {
+	n := float64(len(values))
+	if n < 2 {
+		return 0, false
+	}
+	var sx, sy, sxx, sxy float64
+	for i, t := range times {
+		x := t.Sub(times[0]).Hours()
+		y := float64(values[i])
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / d, true
+}
+
+// Trend is the direction in which a measure evolves.
+type Trend int
+
+// Trends, TrendUnknown when there is not enough data.
+const (
+	TrendUnknown Trend = iota
+	TrendDown
+	TrendStable
+	TrendUp
+)
+
+var trendNames = [...]string{"unknown", "down", "stable", "up"}
+
+func (t Trend) String() string {
+	if t < 0 || int(t) >= len(trendNames) {
+		return "unknown"
+	}
+	return trendNames[t]
+}
+
+// Arrow returns an arrow depicting the trend: "↑", "↓", "→", or "?" if it
+// is unknown.
+func (t Trend) Arrow() string {
+	switch t {
+	case TrendUp:
+		return "↑"
+	case TrendDown:
+		return "↓"
+	case TrendStable:
+		return "→"
+	}
+	return "?"
+}
+
+// defaultTrendThresholds are the changes per hour below which a metric is
+// considered stable.
+var defaultTrendThresholds = map[string]float32{
+	"Temperature": 0.5,
+	"Humidity":    2,
+	"CO2":         50,
+	"Noise":       5,
+	"Pressure":    0.5,
+}
+
+// SetTrendThreshold sets the change per hour of metric below which Trend
+// reports it as stable.
+func (h *History) SetTrendThreshold(metric string, perHour float32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.thresholds[metric] = perHour
+}
+
+// Trend returns the direction of metric for moduleID, from the slope of a
+// straight line fitted to the measures within window of the most recent one.
+// Unlike Netatmo's own trends it reacts as fast as the window allows.
+func (h *History) Trend(moduleID, metric string, window time.Duration) Trend {
+	times, values := h.series(moduleID, metric, window)
+	slope, ok := linearSlope(times, values)
+	if !ok {
+		return TrendUnknown
+	}
+
+	h.mu.Lock()
+	threshold, ok := h.thresholds[metric]
+	h.mu.Unlock()
+	if !ok {
+		threshold = defaultTrendThresholds[metric]
+	}
+
+	switch {
+	case slope > float64(threshold):
+		return TrendUp
+	case slope < -float64(threshold):
+		return TrendDown
+	}
+	return TrendStable
+}
+
+// IsStuck reports whether the last samples measures of metric for moduleID
+// are all identical. Real conditions always fluctuate slightly, so a flat
+// line over many measures usually means a frozen sensor. It returns false if
+// fewer measures were recorded.
+func (h *History) IsStuck(moduleID, metric string, samples int) bool {
+	_, values := h.series(moduleID, metric, 0)
+	if samples < 2 || len(values) < samples {
+		return false
+	}
+	last := values[len(values)-samples:]
+	for _, v := range last[1:] {
+		if v != last[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// RainDelta returns the rain in mm that fell on moduleID between its last
+// two recorded measures, from the daily total Rain1Day. The reset of that
+// total at the station's local midnight is detected from the date, or from
+// a decreasing total if the time zone is unknown, in which case the new
+// total is the rain since midnight; rain between the previous measure and
+// midnight is then missed. ok is false if fewer than two measures have a
+// daily total.
+func (h *History) RainDelta(moduleID string) (float32, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := h.modules[moduleID]
+	if len(list) < 2 {
+		return 0, false
+	}
+	prev, cur := list[len(list)-2], list[len(list)-1]
+	before, ok1 := toFloat32(prev.values["Rain1Day"])
+	after, ok2 := toFloat32(cur.values["Rain1Day"])
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	if after < before || newDay(prev, cur) {
+		return after, true
+	}
+	return after - before, true
+}
+
+// newDay reports whether cur was measured on a later local day than prev.
+// It is false if the time zone is unknown.
+func newDay(prev, cur historyEntry) bool {
+	if cur.loc == nil {
+		return false
+	}
+	y1, m1, d1 := prev.time.In(cur.loc).Date()
+	y2, m2, d2 := cur.time.In(cur.loc).Date()
+	return y1 != y2 || m1 != m2 || d1 != d2
+}
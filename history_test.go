@@ -0,0 +1,28 @@
+package netatmo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistorySkipsZeroTimestamp(t *testing.T) {
+	collection := func(ts int64, temp float32) *DeviceCollection {
+		dc := &DeviceCollection{}
+		dc.Body.Devices = []*Device{{
+			ID:            "s",
+			Type:          TypeStation,
+			DashboardData: DashboardData{LastMeasure: int64p(ts), Temperature: float32p(temp), Pressure: float32p(1013)},
+		}}
+		return dc
+	}
+
+	h := NewHistory(10)
+	h.Add(collection(0, -40))
+	h.Add(collection(time.Now().Unix(), 20))
+	if v, ok := h.Min("s", "Temperature", time.Hour); !ok || v != 20 {
+		t.Errorf("Min = %v, %v, want 20 without the unset measure", v, ok)
+	}
+	if _, ok := PressureTendency(collection(0, 20), collection(3600, 20), "s"); ok {
+		t.Error("PressureTendency used a measure without a timestamp")
+	}
+}
@@ -0,0 +1,409 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scales accepted by getmeasure.
+const (
+	ScaleMax    = "max"
+	Scale30Min  = "30min"
+	Scale1Hour  = "1hour"
+	Scale3Hours = "3hours"
+	Scale1Day   = "1day"
+	Scale1Week  = "1week"
+	Scale1Month = "1month"
+)
+
+// MeasureRequest describes a getmeasure query.
+type MeasureRequest struct {
+	DeviceID string    // MAC address of the station
+	ModuleID string    // MAC address of the module; empty for the station itself
+	Scale    string    // one of the Scale constants
+	Types    []string  // measure types, e.g. "temperature", "humidity"
+	Begin    time.Time // zero for no lower bound; may be in any location
+	End      time.Time // zero for no upper bound; may be in any location
+	Limit    int       // maximum number of points (at most 1024); 0 for the default
+
+	// RealTime changes the timestamps of aggregated scales. By default
+	// Netatmo reports each aggregate at the middle of its interval (begin +
+	// scale/2); with RealTime it is reported at the start of the interval.
+	// It has no effect with ScaleMax.
+	RealTime bool
+
+	// Optimize requests Netatmo's compact format, in which runs of points
+	// are sent as a start time, a step and a list of values. Each run has
+	// its own step, which varies with ScaleMax; points always carry their
+	// own timestamp in the result either way.
+	Optimize bool
+}
+
+// MeasurePoint holds the values of all requested types at one timestamp.
+// Values are in the order of MeasureResult.Types; nil means no data.
+type MeasurePoint struct {
+	Time   time.Time
+	Values []*float64
+}
+
+// MeasureResult is the response of GetMeasure.
+type MeasureResult struct {
+	Scale  string
+	Types  []string
+	Points []MeasurePoint
+}
+
+// measureTypes are the getmeasure types valid for each module type.
+var measureTypes = map[string][]string{
+	TypeStation: {
+		"temperature", "min_temp", "max_temp", "date_min_temp", "date_max_temp",
+		"humidity", "min_hum", "max_hum", "date_min_hum", "date_max_hum",
+		"co2", "min_co2", "max_co2", "date_min_co2", "date_max_co2",
+		"pressure", "min_pressure", "max_pressure", "date_min_pressure", "date_max_pressure",
+		"noise", "min_noise", "max_noise", "date_min_noise", "date_max_noise",
+	},
+	TypeOutdoor: {
+		"temperature", "min_temp", "max_temp", "date_min_temp", "date_max_temp",
+		"humidity", "min_hum", "max_hum", "date_min_hum", "date_max_hum",
+	},
+	TypeIndoor: {
+		"temperature", "min_temp", "max_temp", "date_min_temp", "date_max_temp",
+		"humidity", "min_hum", "max_hum", "date_min_hum", "date_max_hum",
+		"co2", "min_co2", "max_co2", "date_min_co2", "date_max_co2",
+	},
+	TypeRain: {"rain", "sum_rain"},
+	TypeWind: {"windstrength", "windangle", "guststrength", "gustangle", "date_max_gust"},
+}
+
+// MetricsForType returns the measure types GetMeasure accepts for modules
+// of type t, e.g. TypeOutdoor, or nil for an unknown type. Aggregates such
+// as "min_temp" or "sum_rain" require a scale other than ScaleMax.
+func MetricsForType(t string) []string {
+	return append([]string(nil), measureTypes[t]...)
+}
+
+// Validate checks that req has the required fields and valid values, so
+// that mistakes are reported before calling Netatmo.
+func (req MeasureRequest) Validate() error {
+	switch {
+	case req.DeviceID == "":
+		return errors.New("measure request without device ID")
+	case len(req.Types) == 0:
+		return errors.New("measure request without types")
+	case req.Limit < 0 || req.Limit > maxMeasurePoints:
+		return fmt.Errorf("measure request limit %d out of range 0-%d", req.Limit, maxMeasurePoints)
+	case !req.Begin.IsZero() && !req.End.IsZero() && req.End.Before(req.Begin):
+		return errors.New("measure request ends before it begins")
+	}
+	if _, ok := scaleSteps[req.Scale]; !ok {
+		return fmt.Errorf("invalid measure scale %q", req.Scale)
+	}
+	return nil
+}
+
+// toValues returns the query parameters of req.
+func (req MeasureRequest) toValues() url.Values {
+	data := url.Values{
+		"device_id": {req.DeviceID},
+		"scale":     {req.Scale},
+		"type":      {strings.Join(req.Types, ",")},
+		"optimize":  {strconv.FormatBool(req.Optimize)},
+		"real_time": {strconv.FormatBool(req.RealTime)},
+	}
+	if req.ModuleID != "" {
+		data.Set("module_id", req.ModuleID)
+	}
+	if !req.Begin.IsZero() {
+		data.Set("date_begin", strconv.FormatInt(req.Begin.Unix(), 10))
+	}
+	if !req.End.IsZero() {
+		data.Set("date_end", strconv.FormatInt(req.End.Unix(), 10))
+	}
+	if req.Limit > 0 {
+		data.Set("limit", strconv.Itoa(req.Limit))
+	}
+	return data
+}
+
+// GetMeasure retrieves the measure history of a station or module. req is
+// checked with Validate first.
+func (c *Client) GetMeasure(ctx context.Context, req MeasureRequest) (*MeasureResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var holder struct {
+		Body json.RawMessage `json:"body"`
+	}
+	resp, err := c.doHTTPGet(ctx, c.baseURL+measurePath, req.toValues())
+	if _, err := processHTTPResponse(resp, err, &holder); err != nil {
+		return nil, err
+	}
+
+	points, err := parseMeasureBody(holder.Body, len(req.Types))
+	if err != nil {
+		return nil, err
+	}
+	result := &MeasureResult{Scale: req.Scale, Types: req.Types, Points: points}
+	sort.Slice(result.Points, func(i, j int) bool {
+		return result.Points[i].Time.Before(result.Points[j].Time)
+	})
+	return result, nil
+}
+
+// In returns a copy of r with the timestamps in loc, e.g. the station's
+// time zone as returned by Device.TimeZone.
+func (r *MeasureResult) In(loc *time.Location) *MeasureResult {
+	local := &MeasureResult{Scale: r.Scale, Types: r.Types, Points: make([]MeasurePoint, len(r.Points))}
+	for i, p := range r.Points {
+		local.Points[i] = MeasurePoint{Time: p.Time.In(loc), Values: p.Values}
+	}
+	return local
+}
+
+// parseMeasureBody decodes the body of a getmeasure response, in either the
+// plain format (an object keyed by timestamp) or the optimized one (a list
+// of runs of evenly spaced values).
+func parseMeasureBody(body json.RawMessage, ntypes int) ([]MeasurePoint, error) {
+	var points []MeasurePoint
+	add := func(ts int64, values []*float64) error {
+		if len(values) != ntypes {
+			return fmt.Errorf("measure at %d has %d values for %d types", ts, len(values), ntypes)
+		}
+		points = append(points, MeasurePoint{Time: time.Unix(ts, 0).UTC(), Values: values})
+		return nil
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		var runs []struct {
+			BegTime  int64        `json:"beg_time"`
+			StepTime int64        `json:"step_time"`
+			Value    [][]*float64 `json:"value"`
+		}
+		if err := json.Unmarshal(body, &runs); err != nil {
+			return nil, err
+		}
+		for _, run := range runs {
+			for i, values := range run.Value {
+				if err := add(run.BegTime+int64(i)*run.StepTime, values); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return points, nil
+	}
+
+	var byTime map[string][]*float64
+	if err := json.Unmarshal(body, &byTime); err != nil {
+		return nil, err
+	}
+	for k, values := range byTime {
+		ts, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid measure timestamp %q: %w", k, err)
+		}
+		if err := add(ts, values); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// maxMeasurePoints is the maximum number of points getmeasure returns.
+const maxMeasurePoints = 1024
+
+// GetMeasureStream retrieves a long measure history page by page, sending
+// the points on the returned channel as pages arrive, oldest first. Each page
+// holds up to req.Limit points, 1024 by default. The point channel is closed
+// when done; the error channel then receives at most one error, including
+// the cancellation of ctx.
+func (c *Client) GetMeasureStream(ctx context.Context, req MeasureRequest) (<-chan MeasurePoint, <-chan error) {
+	points := make(chan MeasurePoint)
+	errc := make(chan error, 1)
+	if req.Limit <= 0 || req.Limit > maxMeasurePoints {
+		req.Limit = maxMeasurePoints
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(points)
+		for {
+			result, err := c.GetMeasure(ctx, req)
+			if err != nil {
+				errc <- err
+				return
+			}
+			for _, p := range result.Points {
+				select {
+				case points <- p:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+			if len(result.Points) < req.Limit {
+				return
+			}
+			req.Begin = result.Points[len(result.Points)-1].Time.Add(time.Second)
+			if !req.End.IsZero() && req.Begin.After(req.End) {
+				return
+			}
+		}
+	}()
+	return points, errc
+}
+
+// GetMeasureLast retrieves the given measure types of a station or module
+// over the last window, e.g. 24 hours. Read must have been called first for
+// modules other than base stations, to find their station.
+func (c *Client) GetMeasureLast(ctx context.Context, moduleID string, types []string, scale string, window time.Duration) (*MeasureResult, error) {
+	req := MeasureRequest{
+		DeviceID: c.stationOf(moduleID),
+		Scale:    scale,
+		Types:    types,
+		Begin:    time.Now().Add(-window),
+	}
+	if req.DeviceID != moduleID {
+		req.ModuleID = moduleID
+	}
+	return c.GetMeasure(ctx, req)
+}
+
+// TimedValue is a single value of a measure series.
+type TimedValue struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series returns the values of measure type typ (case insensitive), oldest
+// first. Timestamps at which typ has no value are skipped. It returns nil if
+// typ was not requested.
+func (r *MeasureResult) Series(typ string) []TimedValue {
+	idx := -1
+	for i, t := range r.Types {
+		if strings.EqualFold(t, typ) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil
+	}
+	series := make([]TimedValue, 0, len(r.Points))
+	for _, p := range r.Points {
+		if v := p.Values[idx]; v != nil {
+			series = append(series, TimedValue{Time: p.Time, Value: *v})
+		}
+	}
+	return series
+}
+
+// scaleSteps is the nominal interval between points of each scale. Raw
+// measures are taken about every 5 minutes.
+var scaleSteps = map[string]time.Duration{
+	ScaleMax:    5 * time.Minute,
+	Scale30Min:  30 * time.Minute,
+	Scale1Hour:  time.Hour,
+	Scale3Hours: 3 * time.Hour,
+	Scale1Day:   24 * time.Hour,
+	Scale1Week:  7 * 24 * time.Hour,
+	Scale1Month: 31 * 24 * time.Hour,
+}
+
+// TimeRange is the period from Start to End.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Gaps returns the periods in which Netatmo returned no data, i.e. between
+// consecutive points more than one and a half steps of the scale apart.
+// Each range starts and ends at the points surrounding the gap.
+func (r *MeasureResult) Gaps() []TimeRange {
+	step, ok := scaleSteps[r.Scale]
+	if !ok {
+		return nil
+	}
+	var gaps []TimeRange
+	for i := 1; i < len(r.Points); i++ {
+		prev, cur := r.Points[i-1].Time, r.Points[i].Time
+		if cur.Sub(prev) > step*3/2 {
+			gaps = append(gaps, TimeRange{Start: prev, End: cur})
+		}
+	}
+	return gaps
+}
+
+// Filled returns a copy of r in which each gap is filled with points whose
+// values are all nil, at the nominal step of the scale, so that charts do
+// not connect points across missing data.
+func (r *MeasureResult) Filled() *MeasureResult {
+	filled := &MeasureResult{Scale: r.Scale, Types: r.Types}
+	step, ok := scaleSteps[r.Scale]
+	for i, p := range r.Points {
+		if ok && i > 0 {
+			prev := r.Points[i-1].Time
+			if p.Time.Sub(prev) > step*3/2 {
+				for t := prev.Add(step); p.Time.Sub(t) > step/2; t = t.Add(step) {
+					filled.Points = append(filled.Points, MeasurePoint{Time: t, Values: make([]*float64, len(r.Types))})
+				}
+			}
+		}
+		filled.Points = append(filled.Points, p)
+	}
+	return filled
+}
+
+// TemperatureHumidity is a temperature and humidity measure. Either value
+// may be nil if it is missing.
+type TemperatureHumidity struct {
+	Time        time.Time
+	Temperature *float64
+	Humidity    *float64
+}
+
+// TemperatureHumiditySeries is a time-ordered list of measures.
+type TemperatureHumiditySeries []TemperatureHumidity
+
+// History24h returns the temperature and humidity of a station or module over
+// the last 24 hours, at 30 minutes resolution. Read must have been called
+// first for modules other than base stations, to find their station.
+func (c *Client) History24h(ctx context.Context, moduleID string) (TemperatureHumiditySeries, error) {
+	result, err := c.GetMeasureLast(ctx, moduleID, []string{"temperature", "humidity"}, Scale30Min, 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(TemperatureHumiditySeries, 0, len(result.Points))
+	for _, p := range result.Points {
+		th := TemperatureHumidity{Time: p.Time}
+		if len(p.Values) > 0 {
+			th.Temperature = p.Values[0]
+		}
+		if len(p.Values) > 1 {
+			th.Humidity = p.Values[1]
+		}
+		series = append(series, th)
+	}
+	return series, nil
+}
+
+// stationOf returns the ID of the station moduleID belongs to according to
+// the last Read, or moduleID itself if it is unknown or a station.
+func (c *Client) stationOf(moduleID string) string {
+	for _, station := range c.Collection().Stations() {
+		for _, module := range station.linked() {
+			if module.ID == moduleID {
+				return station.ID
+			}
+		}
+	}
+	return moduleID
+}
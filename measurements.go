@@ -0,0 +1,167 @@
+package netatmo
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Metric identifies a sensor value of Measurements. Metrics can be combined
+// as a bit set.
+type Metric uint32
+
+// Metrics of Measurements, named after the keys of Data().
+const (
+	MetricTemperature Metric = 1 << iota
+	MetricMinTemp
+	MetricMaxTemp
+	MetricTempTrend
+	MetricHumidity
+	MetricCO2
+	MetricNoise
+	MetricPressure
+	MetricAbsolutePressure
+	MetricPressureTrend
+	MetricRain
+	MetricRain1Hour
+	MetricRain1Day
+	MetricWindAngle
+	MetricWindStrength
+	MetricGustAngle
+	MetricGustStrength
+	MetricDateMinTemp
+	MetricDateMaxTemp
+)
+
+// Measurements holds the sensor values of a module as plain values, so that
+// it can be filled without allocating. Present tells which values are set.
+type Measurements struct {
+	LastMeasure      int64
+	Temperature      float32
+	MinTemp          float32
+	MaxTemp          float32
+	TempTrend        string
+	Humidity         int32
+	CO2              int32
+	Noise            int32
+	Pressure         float32
+	AbsolutePressure float32
+	PressureTrend    string
+	Rain             float32
+	Rain1Hour        float32
+	Rain1Day         float32
+	WindAngle        int32
+	WindStrength     int32
+	GustAngle        int32
+	GustStrength     int32
+	DateMinTemp      time.Time
+	DateMaxTemp      time.Time
+
+	Present Metric
+}
+
+// Has reports whether all of metrics are set in m.
+func (m *Measurements) Has(metrics Metric) bool {
+	return m.Present&metrics == metrics
+}
+
+// MeasurementsInto fills m with the sensor values of d. Unlike Data it does
+// not allocate, which matters when rendering many modules at a high rate.
+// With WithUserUnits, values are converted to the units preferred by the
+// account, wind speeds being rounded. It returns false, leaving m empty, if
+// d has no measure.
+func (d *Device) MeasurementsInto(m *Measurements) bool {
+	*m = Measurements{}
+	dd := &d.DashboardData
+	if dd.LastMeasure == nil {
+		return false
+	}
+	m.LastMeasure = *dd.LastMeasure
+
+	units := d.units
+	setFloat := func(dst *float32, src *float32, metric Metric, name string) {
+		if src != nil {
+			*dst = units.convert(name, *src)
+			m.Present |= metric
+		}
+	}
+	setInt := func(dst *int32, src *int32, metric Metric, name string) {
+		if src != nil {
+			*dst = int32(math.Round(float64(units.convert(name, float32(*src)))))
+			m.Present |= metric
+		}
+	}
+	setString := func(dst *string, src string, metric Metric) {
+		if src != "" {
+			*dst = src
+			m.Present |= metric
+		}
+	}
+
+	setFloat(&m.Temperature, dd.Temperature, MetricTemperature, "Temperature")
+	setFloat(&m.MinTemp, dd.MinTemp, MetricMinTemp, "MinTemp")
+	setFloat(&m.MaxTemp, dd.MaxTemp, MetricMaxTemp, "MaxTemp")
+	setString(&m.TempTrend, dd.TempTrend, MetricTempTrend)
+	setInt(&m.Humidity, dd.Humidity, MetricHumidity, "Humidity")
+	setInt(&m.CO2, dd.CO2, MetricCO2, "CO2")
+	setInt(&m.Noise, dd.Noise, MetricNoise, "Noise")
+	setFloat(&m.Pressure, dd.Pressure, MetricPressure, "Pressure")
+	setFloat(&m.AbsolutePressure, dd.AbsolutePressure, MetricAbsolutePressure, "AbsolutePressure")
+	setString(&m.PressureTrend, dd.PressureTrend, MetricPressureTrend)
+	setFloat(&m.Rain, dd.Rain, MetricRain, "Rain")
+	setFloat(&m.Rain1Hour, dd.Rain1Hour, MetricRain1Hour, "Rain1Hour")
+	setFloat(&m.Rain1Day, dd.Rain1Day, MetricRain1Day, "Rain1Day")
+	setInt(&m.WindAngle, dd.WindAngle, MetricWindAngle, "WindAngle")
+	setInt(&m.WindStrength, dd.WindStrength, MetricWindStrength, "WindStrength")
+	setInt(&m.GustAngle, dd.GustAngle, MetricGustAngle, "GustAngle")
+	setInt(&m.GustStrength, dd.GustStrength, MetricGustStrength, "GustStrength")
+	if t, ok := dd.MinTempTime(); ok {
+		m.DateMinTemp = t
+		m.Present |= MetricDateMinTemp
+	}
+	if t, ok := dd.MaxTempTime(); ok {
+		m.DateMaxTemp = t
+		m.Present |= MetricDateMaxTemp
+	}
+	return true
+}
+
+// normalizedMetrics are the keys of NormalizedRow: every numeric value of
+// Data() and Info().
+var normalizedMetrics = [...]string{
+	"Temperature", "MinTemp", "MaxTemp", "Humidity", "CO2", "Noise",
+	"Pressure", "AbsolutePressure", "Rain", "Rain1Hour", "Rain1Day",
+	"WindAngle", "WindStrength", "GustAngle", "GustStrength",
+	"BatteryPercent", "WifiStatus", "RFStatus",
+}
+
+// NormalizedRow returns the numeric values of Data() and Info() with the
+// same keys for every module type, nil for the metrics d does not report,
+// e.g. to store all modules in one table. Trends and times are left out.
+func (d *Device) NormalizedRow() map[string]*float64 {
+	row := make(map[string]*float64, len(normalizedMetrics))
+	values := make(map[string]interface{}, 3)
+	if d.DashboardData.LastMeasure != nil {
+		_, values = d.Data()
+	}
+	// Read directly rather than through Info, which needs a measure: an
+	// unreachable module still reports its battery and signal
+	if d.BatteryPercent != nil {
+		values["BatteryPercent"] = *d.BatteryPercent
+	}
+	if d.WifiStatus != nil {
+		values["WifiStatus"] = *d.WifiStatus
+	}
+	if d.RFStatus != nil {
+		values["RFStatus"] = *d.RFStatus
+	}
+	for _, metric := range normalizedMetrics {
+		row[metric] = nil
+		if f, ok := toFloat32(values[metric]); ok {
+			// Shortest decimal form, so that 20.1 does not become 20.100000381
+			v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+			row[metric] = &v
+		}
+	}
+	return row
+}
@@ -0,0 +1,41 @@
+package netatmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+)
+
+// NewMockClient returns a Client that does not contact Netatmo: Read
+// returns a copy of dc, and other API calls fail with a 404 status. It is
+// meant for testing code built on this package.
+func NewMockClient(dc *DeviceCollection) *Client {
+	data, err := json.Marshal(dc)
+	if err != nil {
+		panic("netatmo: cannot encode mock collection: " + err.Error())
+	}
+	c, _ := NewClient(&Config{}, WithoutTokenSaving())
+	c.httpClient = &http.Client{Transport: &mockTransport{stations: data}}
+	return c
+}
+
+// mockTransport answers getstationsdata requests with a canned payload.
+type mockTransport struct {
+	stations []byte
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"code":404,"message":"not mocked"}}`))),
+		Request:    req,
+	}
+	if path.Base(req.URL.Path) == path.Base(devicePath) {
+		resp.StatusCode = http.StatusOK
+		resp.Body = io.NopCloser(bytes.NewReader(t.stations))
+	}
+	return resp, nil
+}
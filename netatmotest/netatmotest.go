@@ -0,0 +1,45 @@
+// Package netatmotest provides utilities for testing code using the netatmo
+// package, kept apart so that programs do not link them.
+package netatmotest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// NewTokenServer starts a fake OAuth2 token endpoint for testing token
+// refreshes together with netatmo.WithTokenURL. Each refresh is answered
+// with the next of tokens, the last one being repeated; a nil token is
+// answered with an invalid_grant error. The server must be closed after use.
+func NewTokenServer(tokens ...*oauth2.Token) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		var token *oauth2.Token
+		if len(tokens) > 0 {
+			token = tokens[0]
+		}
+		if len(tokens) > 1 {
+			tokens = tokens[1:]
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") != "refresh_token" || token == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  token.AccessToken,
+			"refresh_token": token.RefreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    int64(time.Until(token.Expiry) / time.Second),
+		})
+	}))
+}
@@ -0,0 +1,198 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option configures a Client created by NewClient or
+// NewClientWithCredentials. Options are applied in order, so a later option
+// overrides an earlier one; without options the defaults documented on each
+// option apply.
+type Option func(*Client)
+
+// WithBaseContext sets the context used for token refreshes and for requests
+// made without one, such as Read. Once ctx is done, tokens can no longer be
+// refreshed and Read fails. Defaults to context.Background().
+func WithBaseContext(ctx context.Context) Option {
+	return func(c *Client) {
+		c.baseCtx = ctx
+	}
+}
+
+// WithoutTokenSaving disables writing refreshed tokens back to the config
+// file, e.g. when it is read-only or tokens are managed externally. The
+// Config is still updated in memory.
+func WithoutTokenSaving() Option {
+	return func(c *Client) {
+		c.noSave = true
+	}
+}
+
+// WithSaveErrorHandler sets the function receiving errors from saving
+// refreshed tokens. Such errors never fail the request, which proceeds with
+// the new token. By default they are logged with the standard logger.
+func WithSaveErrorHandler(fn func(error)) Option {
+	return func(c *Client) {
+		c.onSaveErr = fn
+	}
+}
+
+// WithTimeout sets the default timeout of API requests, including reading
+// the response. Defaults to no timeout other than the request context's.
+func WithTimeout(d time.Duration) Option {
+	return WithEndpointTimeout("", d)
+}
+
+// WithEndpointTimeout sets the timeout of requests to one endpoint, named
+// after the last element of its path, e.g. "getmeasure" or
+// "getstationsdata". It overrides the default set by WithTimeout.
+func WithEndpointTimeout(endpoint string, d time.Duration) Option {
+	return func(c *Client) {
+		if c.timeouts == nil {
+			c.timeouts = make(map[string]time.Duration)
+		}
+		c.timeouts[endpoint] = d
+	}
+}
+
+// WithAppType sets the app_type sent by Read. Defaults to AppStation, the
+// only product line whose data this package decodes.
+func WithAppType(appType string) Option {
+	return func(c *Client) {
+		c.appType = appType
+	}
+}
+
+// WithBaseURL sets the URL of the Netatmo API, e.g. to use a proxy or a
+// local test server. Defaults to "https://api.netatmo.com/".
+func WithBaseURL(u string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(u, "/") + "/"
+	}
+}
+
+// WithTokenURL sets the URL of the OAuth2 token endpoint, e.g. that of
+// netatmotest.NewTokenServer. Defaults to the token endpoint of the base URL.
+func WithTokenURL(u string) Option {
+	return func(c *Client) {
+		c.tokenURL = u
+	}
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification. It is
+// INSECURE and only meant for tests against a server such as
+// httptest.NewTLSServer.
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.insecure = true
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections kept open,
+// zero meaning no limit. Defaults to that of http.DefaultTransport.
+func WithMaxIdleConns(n int) Option {
+	return func(c *Client) {
+		c.tuneRT = append(c.tuneRT, func(t *http.Transport) { t.MaxIdleConns = n })
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections kept
+// open to the API host. Defaults to http.DefaultMaxIdleConnsPerHost.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.tuneRT = append(c.tuneRT, func(t *http.Transport) { t.MaxIdleConnsPerHost = n })
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept open, zero
+// meaning no limit. Defaults to that of http.DefaultTransport.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.tuneRT = append(c.tuneRT, func(t *http.Transport) { t.IdleConnTimeout = d })
+	}
+}
+
+// WithRequestSigner sets a function adding computed headers to every
+// request, including token refreshes, right before it is sent, e.g. to
+// satisfy a proxy requiring signed requests.
+func WithRequestSigner(sign RequestSigner) Option {
+	return func(c *Client) {
+		c.signer = sign
+	}
+}
+
+// WithTransportWrapper wraps the HTTP transport used for all requests,
+// including token refreshes, e.g. with NewRecorder or to add logging.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(c *Client) {
+		c.wrapRT = wrap
+	}
+}
+
+// WithUserUnits makes Device.Formatted and Device.MeasurementsInto convert
+// values to the units chosen in the Netatmo app of the account, as returned
+// by DeviceCollection.UserPrefs. Data and the other accessors keep Netatmo's
+// metric units. By default values are not converted.
+func WithUserUnits() Option {
+	return func(c *Client) {
+		c.userUnits = true
+	}
+}
+
+// WithHomesDataTTL sets how long GetHomesData results are cached. Zero
+// disables caching. Defaults to one hour.
+func WithHomesDataTTL(d time.Duration) Option {
+	return func(c *Client) {
+		c.homesData.ttl = d
+	}
+}
+
+// WithHomeStatusTTL sets how long GetHomeStatus results are cached. Zero,
+// the default, disables caching.
+func WithHomeStatusTTL(d time.Duration) Option {
+	return func(c *Client) {
+		c.homeStatus.ttl = d
+	}
+}
+
+// WithResponseDecoder sets a function transforming the body of every API
+// response before it is processed, as an escape hatch for proxies or
+// gateways returning slightly non-standard responses. Token requests are not
+// affected.
+func WithResponseDecoder(dec ResponseDecoder) Option {
+	return func(c *Client) {
+		c.decoder = dec
+	}
+}
+
+// WithTokenRefreshMargin sets how long before its expiry the access token
+// is refreshed, so that it does not expire while a request is in flight.
+// Defaults to one minute.
+func WithTokenRefreshMargin(d time.Duration) Option {
+	return func(c *Client) {
+		c.margin = d
+	}
+}
+
+// WithTokenRetryPolicy sets how token refreshes failing with a network or
+// server error are retried. Refreshes rejected by Netatmo, e.g. because the
+// refresh token was revoked, are never retried. Defaults to no retries.
+func WithTokenRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.tokenRetry = p
+	}
+}
+
+// WithMaxSeedTokenAge sets how long after its expiry a configured access
+// token without refresh token is still accepted by NewClient, which
+// otherwise fails with ErrReauthRequired. Requests with such a token fail
+// with ErrReauthRequired too. A negative age disables the check. Defaults to
+// 24 hours.
+func WithMaxSeedTokenAge(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxSeedAge = d
+	}
+}
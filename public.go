@@ -0,0 +1,175 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PublicDataRequest describes a getpublicdata query for the public stations
+// within a bounding box.
+type PublicDataRequest struct {
+	LatNE        float32  // latitude of the north east corner
+	LonNE        float32  // longitude of the north east corner
+	LatSW        float32  // latitude of the south west corner
+	LonSW        float32  // longitude of the south west corner
+	RequiredData []string // only return stations measuring these, e.g. "rain"
+	Filter       bool     // exclude stations with abnormal temperature measures
+}
+
+// PublicStation is a public weather station.
+type PublicStation struct {
+	ID          string                   `json:"_id"`
+	Place       Place                    `json:"place"`
+	Mark        *int32                   `json:"mark,omitempty"`
+	Measures    map[string]PublicMeasure `json:"measures"` // by module ID
+	Modules     []string                 `json:"modules"`
+	ModuleTypes map[string]string        `json:"module_types"`
+}
+
+// PublicMeasure holds the latest measures of a public station's module.
+// Temperature, humidity and pressure come as Res, values by timestamp in the
+// order of Type; rain and wind have dedicated fields.
+type PublicMeasure struct {
+	Res  map[string][]*float64 `json:"res,omitempty"`
+	Type []string              `json:"type,omitempty"`
+
+	Rain60Min   *float64 `json:"rain_60min,omitempty"`
+	Rain24H     *float64 `json:"rain_24h,omitempty"`
+	RainLive    *float64 `json:"rain_live,omitempty"`
+	RainTimeUTC *int64   `json:"rain_timeutc,omitempty"`
+
+	WindStrength *float64 `json:"wind_strength,omitempty"`
+	WindAngle    *float64 `json:"wind_angle,omitempty"`
+	GustStrength *float64 `json:"gust_strength,omitempty"`
+	GustAngle    *float64 `json:"gust_angle,omitempty"`
+	WindTimeUTC  *int64   `json:"wind_timeutc,omitempty"`
+}
+
+// Validate checks that the bounding box of req is made of valid
+// coordinates, with its north east corner north of its south west one.
+func (req PublicDataRequest) Validate() error {
+	for _, lat := range []float32{req.LatNE, req.LatSW} {
+		if lat < -90 || lat > 90 {
+			return fmt.Errorf("latitude %g out of range", lat)
+		}
+	}
+	for _, lon := range []float32{req.LonNE, req.LonSW} {
+		if lon < -180 || lon > 180 {
+			return fmt.Errorf("longitude %g out of range", lon)
+		}
+	}
+	if req.LatNE < req.LatSW {
+		return errors.New("north east corner south of south west corner")
+	}
+	return nil
+}
+
+// toValues returns the query parameters of req.
+func (req PublicDataRequest) toValues() url.Values {
+	format := func(f float32) string {
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+	data := url.Values{
+		"lat_ne": {format(req.LatNE)},
+		"lon_ne": {format(req.LonNE)},
+		"lat_sw": {format(req.LatSW)},
+		"lon_sw": {format(req.LonSW)},
+		"filter": {strconv.FormatBool(req.Filter)},
+	}
+	if len(req.RequiredData) > 0 {
+		data.Set("required_data", strings.Join(req.RequiredData, ","))
+	}
+	return data
+}
+
+// PublicData holds the public stations returned by GetPublicData.
+type PublicData struct {
+	Stations []*PublicStation
+
+	// Warnings lists the stations that could not be decoded and were left
+	// out.
+	Warnings []error
+}
+
+// GetPublicData retrieves the public stations within a bounding box. req is
+// checked with Validate first. Stations that cannot be decoded are left out
+// and reported in the Warnings of the result.
+func (c *Client) GetPublicData(ctx context.Context, req PublicDataRequest) (*PublicData, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var holder struct {
+		Body []json.RawMessage `json:"body"`
+	}
+	resp, err := c.doHTTPGet(ctx, c.baseURL+publicDataPath, req.toValues())
+	if _, err := processHTTPResponse(resp, err, &holder); err != nil {
+		return nil, err
+	}
+
+	data := &PublicData{Stations: make([]*PublicStation, 0, len(holder.Body))}
+	for i, raw := range holder.Body {
+		station := &PublicStation{}
+		if err := json.Unmarshal(raw, station); err != nil {
+			data.Warnings = append(data.Warnings, fmt.Errorf("public station %d: %w", i, err))
+			continue
+		}
+		data.Stations = append(data.Stations, station)
+	}
+	return data, nil
+}
+
+// GetPublicDataNear retrieves the public stations within radiusMeters of a
+// point. The bounding box around the circle is queried and the stations
+// outside the circle are left out.
+func (c *Client) GetPublicDataNear(ctx context.Context, lat, lon float32, radiusMeters float64, requiredData []string) (*PublicData, error) {
+	dLat := radiusMeters / metersPerDegree
+	dLon := radiusMeters / (metersPerDegree * math.Cos(float64(lat)*math.Pi/180))
+	clamp := func(v float64, limit float64) float32 {
+		return float32(max(-limit, min(limit, v)))
+	}
+	data, err := c.GetPublicData(ctx, PublicDataRequest{
+		LatNE:        clamp(float64(lat)+dLat, 90),
+		LonNE:        clamp(float64(lon)+dLon, 180),
+		LatSW:        clamp(float64(lat)-dLat, 90),
+		LonSW:        clamp(float64(lon)-dLon, 180),
+		RequiredData: requiredData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var near []*PublicStation
+	for _, s := range data.Stations {
+		loc := s.Place.Location
+		if loc.Latitude == nil || loc.Longitude == nil {
+			continue
+		}
+		if haversine(lat, lon, *loc.Latitude, *loc.Longitude) <= radiusMeters {
+			near = append(near, s)
+		}
+	}
+	data.Stations = near
+	return data, nil
+}
+
+const (
+	earthRadius     = 6371008.8                   // mean radius in meters
+	metersPerDegree = earthRadius * math.Pi / 180 // length of a degree of latitude
+)
+
+// haversine returns the great circle distance in meters between two points.
+func haversine(lat1, lon1, lat2, lon2 float32) float64 {
+	rad := func(deg float32) float64 { return float64(deg) * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,36 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetPublicDataSkipsMalformedStations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":[
+			{"_id":"good","place":{"location":[2.35,48.85]}},
+			{"_id":"bad","place":{"location":[2.35]}}
+		],"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	expiry := time.Now().Add(time.Hour)
+	c, err := NewClientWithCredentials("id", "secret", "token", "refresh", expiry, WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.GetPublicData(context.Background(), PublicDataRequest{LatNE: 49, LonNE: 3, LatSW: 48, LonSW: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Stations) != 1 || data.Stations[0].ID != "good" {
+		t.Errorf("GetPublicData returned %d stations, want only good", len(data.Stations))
+	}
+	if len(data.Warnings) != 1 {
+		t.Errorf("GetPublicData warnings = %v, want one warning", data.Warnings)
+	}
+}
@@ -0,0 +1,132 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// autoRefresh is the state of a background refresh started by
+// StartAutoRefresh.
+type autoRefresh struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the goroutine exits
+	ready  chan struct{} // closed after the first refresh attempt
+
+	mu  sync.Mutex
+	dc  *DeviceCollection
+	raw json.RawMessage
+}
+
+// StartAutoRefresh refreshes station data every interval in the background
+// until ctx is done or StopAutoRefresh is called. Meanwhile Read returns the
+// latest refreshed data without calling the API; calls made during the first
+// refresh wait for it. While refreshes fail, the delay between them doubles,
+// up to an hour, and is reset by the next success. A running auto refresh is
+// stopped first.
+func (c *Client) StartAutoRefresh(ctx context.Context, interval time.Duration) {
+	c.StopAutoRefresh()
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &autoRefresh{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		ready:  make(chan struct{}),
+	}
+	c.refreshMu.Lock()
+	c.refresher = r
+	c.refreshMu.Unlock()
+
+	go c.runAutoRefresh(ctx, r, interval)
+}
+
+// StopAutoRefresh stops the background refresh, if any, and waits for it to
+// exit. Read calls the API again afterwards.
+func (c *Client) StopAutoRefresh() {
+	c.refreshMu.Lock()
+	r := c.refresher
+	c.refresher = nil
+	c.refreshMu.Unlock()
+
+	if r != nil {
+		r.cancel()
+		<-r.done
+	}
+}
+
+// maxRefreshBackoff caps the delay between failing refreshes, unless the
+// refresh interval itself is longer.
+const maxRefreshBackoff = time.Hour
+
+func (c *Client) runAutoRefresh(ctx context.Context, r *autoRefresh, interval time.Duration) {
+	defer close(r.done)
+	defer func() {
+		// Once ctx is done, Read calls the API again
+		c.refreshMu.Lock()
+		if c.refresher == r {
+			c.refresher = nil
+		}
+		c.refreshMu.Unlock()
+	}()
+
+	first := true
+	delay := interval
+	for {
+		dc, raw, err := c.fetch(ctx)
+		if err == nil {
+			r.mu.Lock()
+			r.dc, r.raw = dc, raw
+			r.mu.Unlock()
+			delay = interval
+		} else if ctx.Err() == nil {
+			// Back off exponentially while the API keeps failing
+			delay = min(2*delay, max(maxRefreshBackoff, interval))
+		}
+		c.refreshMu.Lock()
+		c.refreshErr = err
+		c.refreshMu.Unlock()
+
+		if first {
+			close(r.ready)
+			first = false
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// LastRefreshError returns the error of the latest auto refresh, or nil if
+// it succeeded.
+func (c *Client) LastRefreshError() error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refreshErr
+}
+
+// autoRefreshed returns the latest data of the running auto refresh. ok is
+// false if there is none, in which case the caller should fetch the data.
+func (c *Client) autoRefreshed(ctx context.Context) (*DeviceCollection, json.RawMessage, bool, error) {
+	c.refreshMu.Lock()
+	r := c.refresher
+	c.refreshMu.Unlock()
+	if r == nil {
+		return nil, nil, false, nil
+	}
+
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return nil, nil, false, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dc, r.raw, r.dc != nil, nil
+}
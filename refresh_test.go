@@ -0,0 +1,41 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadAfterAutoRefreshContextDone(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":{"devices":[]},"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClientWithCredentials("id", "secret", "token", "refresh", time.Now().Add(time.Hour), WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.StartAutoRefresh(ctx, time.Hour)
+	c.refreshMu.Lock()
+	r := c.refresher
+	c.refreshMu.Unlock()
+	<-r.ready
+	cancel()
+	<-r.done
+
+	before := requests.Load()
+	if _, _, err := c.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() == before {
+		t.Error("Read returned stale auto refreshed data after its context was done")
+	}
+}
@@ -0,0 +1,90 @@
+package netatmo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rule is a condition on a sensor value, e.g. {"CO2", ">", 1500}. Metric is
+// a key of Data() or Info(); Op is one of >, >=, <, <=, == and !=.
+type Rule struct {
+	Metric    string
+	Op        string
+	Threshold float64
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %g", r.Metric, r.Op, r.Threshold)
+}
+
+// Validate checks that the Op of r is supported.
+func (r Rule) Validate() error {
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		return nil
+	}
+	return fmt.Errorf("rule %q: unknown operator %q", r.Metric, r.Op)
+}
+
+// matches reports whether v satisfies the rule.
+func (r Rule) matches(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	case "==":
+		return v == r.Threshold
+	case "!=":
+		return v != r.Threshold
+	}
+	return false
+}
+
+// Alert is a module whose value satisfies a Rule.
+type Alert struct {
+	Station *Device
+	Module  *Device
+	Rule    Rule
+	Value   float64
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s %s %s %g (%g)", a.Module.DisplayName(), a.Rule.Metric, a.Rule.Op, a.Rule.Threshold, a.Value)
+}
+
+// Evaluate returns an Alert for every module and rule whose condition is
+// met. Modules lacking the metric of a rule are not reported. Rules are
+// checked with Validate first.
+func (dc *DeviceCollection) Evaluate(rules []Rule) ([]Alert, error) {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var alerts []Alert
+	dc.Walk(func(station, module *Device) {
+		if module.DashboardData.LastMeasure == nil {
+			return
+		}
+		_, values := module.allValues()
+		for _, rule := range rules {
+			f, ok := toFloat32(values[rule.Metric])
+			if !ok {
+				continue
+			}
+			// Compare the value as displayed, e.g. 20.1 rather than
+			// 20.100000381, so thresholds match exactly
+			v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+			if rule.matches(v) {
+				alerts = append(alerts, Alert{Station: station, Module: module, Rule: rule, Value: v})
+			}
+		}
+	})
+	return alerts, nil
+}
@@ -0,0 +1,47 @@
+package netatmo
+
+import "testing"
+
+func TestEvaluateBoundaries(t *testing.T) {
+	dc := &DeviceCollection{}
+	dc.Body.Devices = []*Device{{
+		ID:            "70:ee:50:00:00:01",
+		Type:          TypeStation,
+		DashboardData: DashboardData{LastMeasure: int64p(100), Temperature: float32p(20.1), CO2: int32p(1500)},
+	}}
+
+	tests := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{"Temperature", "<=", 20.1}, true},
+		{Rule{"Temperature", ">=", 20.1}, true},
+		{Rule{"Temperature", "==", 20.1}, true},
+		{Rule{"Temperature", "!=", 20.1}, false},
+		{Rule{"Temperature", "<", 20.1}, false},
+		{Rule{"Temperature", ">", 20.1}, false},
+		{Rule{"CO2", ">=", 1500}, true},
+		{Rule{"CO2", ">", 1500}, false},
+		{Rule{"Humidity", "<", 100}, false},
+	}
+	for _, tt := range tests {
+		alerts, err := dc.Evaluate([]Rule{tt.rule})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.rule, err)
+		}
+		if got := len(alerts) == 1; got != tt.want {
+			t.Errorf("%v fired = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateUnknownOp(t *testing.T) {
+	dc := &DeviceCollection{}
+	rules := []Rule{{"Temperature", ">", 0}, {"Temperature", "=>", 0}}
+	if _, err := dc.Evaluate(rules); err == nil {
+		t.Error("Evaluate accepted the operator =>")
+	}
+	if err := (Rule{"CO2", "=<", 1000}).Validate(); err == nil {
+		t.Error("Validate accepted the operator =<")
+	}
+}
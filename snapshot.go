@@ -0,0 +1,88 @@
+package netatmo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// snapshotConcurrency is the maximum number of getmeasure calls Snapshot
+// makes at once.
+const snapshotConcurrency = 4
+
+// primaryMeasures are the getmeasure types fetched by Snapshot for each
+// module type.
+var primaryMeasures = map[string][]string{
+	TypeStation: {"temperature", "humidity", "co2", "noise", "pressure"},
+	TypeOutdoor: {"temperature", "humidity"},
+	TypeIndoor:  {"temperature", "humidity", "co2"},
+	TypeRain:    {"rain"},
+	TypeWind:    {"windstrength", "guststrength"},
+}
+
+// Snapshot holds current station data with the recent history of every
+// module.
+type Snapshot struct {
+	Devices *DeviceCollection
+	History map[string]*MeasureResult // by module ID
+	Errors  map[string]error          // failed history queries, by module ID
+}
+
+// Snapshot reads the current station data and the history of the primary
+// measures of every module over the last window, querying modules
+// concurrently. It only fails if Read fails; failed history queries are
+// reported in Snapshot.Errors.
+func (c *Client) Snapshot(ctx context.Context, window time.Duration) (*Snapshot, error) {
+	dc, _, err := c.ReadContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := Scale30Min
+	switch {
+	case window > 14*24*time.Hour:
+		scale = Scale1Day
+	case window > 2*24*time.Hour:
+		scale = Scale3Hours
+	}
+
+	snap := &Snapshot{
+		Devices: dc,
+		History: make(map[string]*MeasureResult),
+		Errors:  make(map[string]error),
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, snapshotConcurrency)
+	)
+	begin := time.Now().Add(-window)
+	dc.Walk(func(station, module *Device) {
+		types, ok := primaryMeasures[module.Type]
+		if !ok {
+			return
+		}
+		req := MeasureRequest{DeviceID: station.ID, Scale: scale, Types: types, Begin: begin}
+		if module != station {
+			req.ModuleID = module.ID
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := c.GetMeasure(ctx, req)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				snap.Errors[module.ID] = err
+				return
+			}
+			snap.History[module.ID] = result
+		}()
+	})
+	wg.Wait()
+	return snap, nil
+}
@@ -0,0 +1,193 @@
+package netatmo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rjp/netatmo-api-go/v2/netatmotest"
+	"golang.org/x/oauth2"
+)
+
+// newAPIServer starts a fake API answering every request with no station.
+func newAPIServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":{"devices":[]},"status":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRefreshSavesConfig(t *testing.T) {
+	tokens := netatmotest.NewTokenServer(&oauth2.Token{
+		AccessToken:  "new-access",
+		RefreshToken: "new-refresh",
+		Expiry:       time.Now().Add(3 * time.Hour),
+	})
+	defer tokens.Close()
+
+	path := filepath.Join(t.TempDir(), "netatmo.toml")
+	cfg := &Config{
+		ClientID:        "id",
+		ClientSecret:    "secret",
+		AccessToken:     "old-access",
+		RefreshToken:    "old-refresh",
+		TokenValidUntil: time.Now().Add(-time.Minute),
+	}
+	cfg.SetPath(path)
+	var refreshed []string
+	cfg.OnTokenRefresh = func(token *oauth2.Token) {
+		refreshed = append(refreshed, token.AccessToken)
+	}
+
+	c, err := NewClient(cfg, WithBaseURL(newAPIServer(t).URL), WithTokenURL(tokens.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(refreshed) != 1 || refreshed[0] != "new-access" {
+		t.Errorf("OnTokenRefresh called with %v, want [new-access]", refreshed)
+	}
+	saved, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.AccessToken != "new-access" || saved.RefreshToken != "new-refresh" {
+		t.Errorf("saved tokens %q, %q, want new-access, new-refresh", saved.AccessToken, saved.RefreshToken)
+	}
+	if saved.ClientID != "id" || saved.ClientSecret != "secret" {
+		t.Errorf("saved config lost its client credentials: %+v", saved)
+	}
+}
+
+func TestRefreshInvalidGrant(t *testing.T) {
+	tokens := netatmotest.NewTokenServer(nil)
+	defer tokens.Close()
+
+	cfg := &Config{AccessToken: "old", RefreshToken: "revoked", TokenValidUntil: time.Now().Add(-time.Minute)}
+	c, err := NewClient(cfg, WithBaseURL(newAPIServer(t).URL), WithTokenURL(tokens.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.Read()
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("Read returned %v, want an *AuthError", err)
+	}
+	if authErr.Code != "invalid_grant" {
+		t.Errorf("AuthError code %q, want invalid_grant", authErr.Code)
+	}
+	if cfg.AccessToken != "old" || cfg.RefreshToken != "revoked" {
+		t.Errorf("failed refresh changed the config tokens to %q, %q", cfg.AccessToken, cfg.RefreshToken)
+	}
+}
+
+func TestNoRefreshTokenReauth(t *testing.T) {
+	cfg := &Config{AccessToken: "old", TokenValidUntil: time.Now().Add(-time.Minute)}
+	c, err := NewClient(cfg, WithBaseURL(newAPIServer(t).URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Read(); !errors.Is(err, ErrReauthRequired) {
+		t.Errorf("Read returned %v, want ErrReauthRequired", err)
+	}
+
+	cfg = &Config{AccessToken: "old", TokenValidUntil: time.Now().Add(-48 * time.Hour)}
+	if _, err := NewClient(cfg); !errors.Is(err, ErrReauthRequired) {
+		t.Errorf("NewClient returned %v, want ErrReauthRequired", err)
+	}
+}
+
+func TestUnchangedTokenNotSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netatmo.toml")
+	cfg := &Config{AccessToken: "access", RefreshToken: "refresh", TokenValidUntil: time.Now().Add(time.Hour)}
+	cfg.SetPath(path)
+	cfg.OnTokenRefresh = func(token *oauth2.Token) {
+		t.Errorf("OnTokenRefresh called with unchanged token %q", token.AccessToken)
+	}
+
+	c, err := NewClient(cfg, WithBaseURL(newAPIServer(t).URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, _, err := c.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unchanged token was saved to the config: %v", err)
+	}
+}
+
+func TestRefreshRetryReleasesLock(t *testing.T) {
+	var failed atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !failed.Swap(true) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","token_type":"Bearer","expires_in":10800}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &refreshSource{
+		oauth:        &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams}},
+		ctx:          ctx,
+		retry:        RetryPolicy{MaxRetries: 1, Delay: time.Hour},
+		refreshToken: "old-refresh",
+	}
+	first := make(chan error, 1)
+	go func() {
+		_, err := s.Token()
+		first <- err
+	}()
+	for !failed.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The first call now waits to retry; another one must not be blocked
+	token, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "new-access" {
+		t.Errorf("got access token %q, want new-access", token.AccessToken)
+	}
+	cancel()
+	if err := <-first; err == nil {
+		t.Error("first call succeeded after its context was done")
+	}
+}
+
+func TestRevokeWithoutRefreshToken(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	c, err := NewClientWithCredentials("id", "secret", "access", "", time.Now().Add(time.Hour), WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Revoke(context.Background()); err == nil {
+		t.Error("Revoke without a refresh token succeeded")
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Revoke sent %d requests, want none", n)
+	}
+}
@@ -0,0 +1,157 @@
+package netatmo
+
+// User is the account owning the stations, as sent with getstationsdata.
+type User struct {
+	Mail           string          `json:"mail"`
+	Administrative UserPreferences `json:"administrative"`
+}
+
+// UserPreferences are the settings chosen in the Netatmo app.
+type UserPreferences struct {
+	Lang         string       `json:"lang"`
+	RegLocale    string       `json:"reg_locale"`
+	Country      string       `json:"country"`
+	Unit         UnitSystem   `json:"unit"`
+	WindUnit     WindUnit     `json:"windunit"`
+	PressureUnit PressureUnit `json:"pressureunit"`
+	FeelLikeAlgo FeelLikeAlgo `json:"feel_like_algo"`
+}
+
+// UnitSystem is the unit system of temperatures and rain.
+type UnitSystem int
+
+// Unit systems.
+const (
+	UnitMetric   UnitSystem = 0 // °C, mm
+	UnitImperial UnitSystem = 1 // °F, in
+)
+
+// WindUnit is the unit of wind speeds.
+type WindUnit int
+
+// Wind units.
+const (
+	WindKmh      WindUnit = 0
+	WindMph      WindUnit = 1
+	WindMs       WindUnit = 2
+	WindBeaufort WindUnit = 3
+	WindKnot     WindUnit = 4
+)
+
+// PressureUnit is the unit of pressures.
+type PressureUnit int
+
+// Pressure units.
+const (
+	PressureMbar PressureUnit = 0
+	PressureInHg PressureUnit = 1
+	PressureMmHg PressureUnit = 2
+)
+
+// FeelLikeAlgo is the algorithm of the perceived temperature.
+type FeelLikeAlgo int
+
+// Perceived temperature algorithms.
+const (
+	FeelLikeHumidex   FeelLikeAlgo = 0
+	FeelLikeHeatIndex FeelLikeAlgo = 1
+)
+
+// UserPrefs returns the preferences of the account, as set in the Netatmo
+// app. They are the zero value, i.e. metric units, if the response had no
+// user block.
+func (dc *DeviceCollection) UserPrefs() UserPreferences {
+	return dc.Body.User.Administrative
+}
+
+// beaufortLimits are the lower wind speeds in km/h of Beaufort forces 1 to
+// 12.
+var beaufortLimits = [...]float32{1, 6, 12, 20, 29, 39, 50, 62, 75, 89, 103, 118}
+
+// convert converts v, a Data() value of metric in Netatmo's metric units,
+// to the preferred units. Other metrics are returned unchanged.
+func (p UserPreferences) convert(metric string, v float32) float32 {
+	switch metric {
+	case "Temperature", "MinTemp", "MaxTemp":
+		if p.Unit == UnitImperial {
+			return v*9/5 + 32
+		}
+	case "Rain", "Rain1Hour", "Rain1Day":
+		if p.Unit == UnitImperial {
+			return v / 25.4
+		}
+	case "Pressure", "AbsolutePressure":
+		switch p.PressureUnit {
+		case PressureInHg:
+			return v * 0.0295300
+		case PressureMmHg:
+			return v * 0.750062
+		}
+	case "WindStrength", "GustStrength":
+		switch p.WindUnit {
+		case WindMph:
+			return v / 1.609344
+		case WindMs:
+			return v / 3.6
+		case WindKnot:
+			return v / 1.852
+		case WindBeaufort:
+			var force float32
+			for _, limit := range beaufortLimits {
+				if v >= limit {
+					force++
+				}
+			}
+			return force
+		}
+	}
+	return v
+}
+
+// format returns the printf format displaying a converted value of metric
+// with its unit. ok is false for metrics without configurable unit.
+func (p UserPreferences) format(metric string) (string, bool) {
+	switch metric {
+	case "Temperature", "MinTemp", "MaxTemp":
+		if p.Unit == UnitImperial {
+			return "%.1f °F", true
+		}
+		return "%.1f °C", true
+	case "Rain", "Rain1Hour", "Rain1Day":
+		if p.Unit == UnitImperial {
+			return "%.2f in", true
+		}
+		return "%.1f mm", true
+	case "Pressure", "AbsolutePressure":
+		switch p.PressureUnit {
+		case PressureInHg:
+			return "%.2f inHg", true
+		case PressureMmHg:
+			return "%.0f mmHg", true
+		}
+		return "%.1f mbar", true
+	case "WindStrength", "GustStrength":
+		switch p.WindUnit {
+		case WindMph:
+			return "%.0f mph", true
+		case WindMs:
+			return "%.1f m/s", true
+		case WindKnot:
+			return "%.0f kn", true
+		case WindBeaufort:
+			return "%.0f Bft", true
+		}
+		return "%.0f km/h", true
+	}
+	return "", false
+}
+
+// applyUnits makes Formatted and MeasurementsInto of all stations and
+// modules use the preferences of the account.
+func (dc *DeviceCollection) applyUnits() {
+	for _, station := range dc.Stations() {
+		for _, module := range station.Modules() {
+			module.units = dc.Body.User.Administrative
+		}
+	}
+}
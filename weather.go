@@ -1,28 +1,55 @@
 package netatmo
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	// DefaultBaseURL is Netatmo API URL
 	baseURL = "https://api.netatmo.com/"
-	// DefaultAuthURL is Netatmo OAuth2 token endpoint
-	authURL = baseURL + "oauth2/token"
-	// DefaultDeviceURL is Netatmo stations data endpoint
-	deviceURL = baseURL + "api/getstationsdata"
+	// authPath is Netatmo OAuth2 token endpoint
+	authPath = "oauth2/token"
+	// devicePath is Netatmo stations data endpoint
+	devicePath = "api/getstationsdata"
+	// measurePath is Netatmo measure history endpoint
+	measurePath = "api/getmeasure"
+	// publicDataPath is Netatmo public stations endpoint
+	publicDataPath = "api/getpublicdata"
+	// homesDataPath is Netatmo Energy homes topology endpoint
+	homesDataPath = "api/homesdata"
+	// homeStatusPath is Netatmo Energy home status endpoint
+	homeStatusPath = "api/homestatus"
+	// setStatePath is Netatmo Energy state change endpoint
+	setStatePath = "api/setstate"
+	// revokePath is Netatmo OAuth2 token revocation endpoint
+	revokePath = "oauth2/revoke"
+)
+
+// Netatmo app_type values, selecting a product line.
+const (
+	AppStation    = "app_station"
+	AppThermostat = "app_thermostat"
+	AppCamera     = "app_camera"
 )
 
 // Config holds OAuth2 credentials and token state, persisted to TOML.
@@ -33,6 +60,10 @@ type Config struct {
 	RefreshToken    string    `toml:"refresh_token"`
 	TokenValidUntil time.Time `toml:"token_valid_until"`
 
+	// OnTokenRefresh, if set, is called with the new token each time it is
+	// refreshed, before it is saved.
+	OnTokenRefresh func(*oauth2.Token) `toml:"-"`
+
 	path string     `toml:"-"`
 	mu   sync.Mutex `toml:"-"`
 }
@@ -47,11 +78,34 @@ func LoadConfig(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// LoadConfigFromReader reads a TOML config from r, e.g. an embedded file or
+// a secret fetched into memory. The config has no file to save refreshed
+// tokens to.
+func LoadConfigFromReader(r io.Reader) (*Config, error) {
+	var cfg Config
+	if _, err := toml.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode TOML config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// SetPath sets the TOML file refreshed tokens are saved to, e.g. for a
+// config built in code or loaded with LoadConfigFromReader.
+func (cfg *Config) SetPath(path string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.path = path
+}
+
 // saveConfig writes cfg back to its TOML file.
 func saveConfig(cfg *Config) error {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
+	if cfg.path == "" {
+		return errors.New("config has no file path, see SetPath")
+	}
+
 	file, err := os.Create(cfg.path)
 	if err != nil {
 		return fmt.Errorf("failed to open config file for writing: %w", err)
@@ -69,17 +123,96 @@ func saveConfig(cfg *Config) error {
 type Client struct {
 	oauth      *oauth2.Config
 	httpClient *http.Client
-	Dc         *DeviceCollection
+	transport  *http.Transport
+	baseRT     http.RoundTripper // transport, possibly signing and wrapped by WithTransportWrapper
+	wrapRT     func(http.RoundTripper) http.RoundTripper
+	signer     RequestSigner
+	tokenSrc   oauth2.TokenSource
+	baseCtx    context.Context
+	appType    string
+	baseURL    string
+	tokenURL   string // overrides baseURL+authPath
+	insecure   bool
+	tuneRT     []func(*http.Transport) // connection pool options
+	noSave     bool
+	userUnits  bool
+	onSaveErr  func(error)
+	timeouts   map[string]time.Duration // by endpoint name, "" for the default
+	decoder    ResponseDecoder
+	maxSeedAge time.Duration // see WithMaxSeedTokenAge
+	margin     time.Duration // see WithTokenRefreshMargin
+	tokenRetry RetryPolicy
+	Dc         *DeviceCollection // result of the latest read, see Collection
 	cfg        *Config
+
+	refreshMu  sync.Mutex
+	refresher  *autoRefresh
+	refreshErr error
+	reads      singleflight.Group
+
+	headerMu   sync.Mutex
+	lastHeader http.Header
+
+	dcMu sync.Mutex // guards Dc
+
+	condMu   sync.Mutex
+	lastRead *conditionalRead
+
+	homesData  ttlCache
+	homeStatus ttlCache
 }
 
 // DeviceCollection holds the list of devices from Netatmo.
 type DeviceCollection struct {
 	Body struct {
 		Devices []*Device `json:"devices"`
+		User    User      `json:"user"`
+	}
+
+	// Warnings lists the stations and modules that could not be decoded
+	// and were left out.
+	Warnings []error `json:"-"`
+}
+
+// UnmarshalJSON decodes stations and modules one by one, so that a
+// malformed one is skipped and reported in Warnings instead of failing the
+// whole collection.
+func (dc *DeviceCollection) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Body struct {
+			Devices []json.RawMessage `json:"devices"`
+			User    User              `json:"user"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
 	}
+
+	dc.Body.User = raw.Body.User
+	dc.Body.Devices = nil
+	dc.Warnings = nil
+	for i, d := range raw.Body.Devices {
+		station := &Device{}
+		if err := json.Unmarshal(d, station); err != nil {
+			dc.Warnings = append(dc.Warnings, fmt.Errorf("station %d: %w", i, err))
+			continue
+		}
+		dc.Body.Devices = append(dc.Body.Devices, station)
+		dc.Warnings = append(dc.Warnings, station.warnings...)
+		station.warnings = nil
+	}
+	return nil
 }
 
+// Module types as reported in Device.Type.
+const (
+	TypeStation = "NAMain"    // base station (indoor)
+	TypeOutdoor = "NAModule1" // outdoor module
+	TypeWind    = "NAModule2" // wind gauge
+	TypeRain    = "NAModule3" // rain gauge
+	TypeIndoor  = "NAModule4" // additional indoor module
+)
+
 // Device represents a station or module.
 type Device struct {
 	ID             string        `json:"_id"`
@@ -103,6 +236,45 @@ type Device struct {
 	HomeName        string `json:"home_name,omitempty"`
 	LastMessage     *int64 `json:"last_message,omitempty"`
 	BatteryVP       *int32 `json:"battery_vp,omitempty"`
+	ReadOnly        *bool  `json:"read_only,omitempty"` // set on stations shared with or favorited by the user
+
+	warnings []error         // modules skipped by UnmarshalJSON
+	units    UserPreferences // display units, set by WithUserUnits
+}
+
+// UnmarshalJSON decodes a device, accepting timestamps as numbers or
+// strings. Linked modules that fail to decode are skipped; a DeviceCollection
+// reports them in its Warnings.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type device Device // without this method
+	var aux struct {
+		*device
+		Modules         []json.RawMessage `json:"modules"`
+		LastStatusStore flexInt64         `json:"last_status_store"`
+		DateSetup       flexInt64         `json:"date_setup"`
+		LastSetup       flexInt64         `json:"last_setup"`
+		LastMessage     flexInt64         `json:"last_message"`
+	}
+	aux.device = (*device)(d)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	d.LastStatusStore = aux.LastStatusStore.v
+	d.DateSetup = aux.DateSetup.v
+	d.LastSetup = aux.LastSetup.v
+	d.LastMessage = aux.LastMessage.v
+
+	d.LinkedModules = nil
+	d.warnings = nil
+	for i, m := range aux.Modules {
+		module := &Device{}
+		if err := json.Unmarshal(m, module); err != nil {
+			d.warnings = append(d.warnings, fmt.Errorf("station %s module %d: %w", d.ID, i, err))
+			continue
+		}
+		d.LinkedModules = append(d.LinkedModules, module)
+	}
+	return nil
 }
 
 // DashboardData holds sensor measurements.
@@ -130,6 +302,46 @@ type DashboardData struct {
 	DateMinTemp *int64 `json:"date_min_temp,omitempty"`
 }
 
+// UnmarshalJSON decodes dashboard data, accepting timestamps as numbers or
+// strings.
+func (dd *DashboardData) UnmarshalJSON(data []byte) error {
+	type dashboardData DashboardData // without this method
+	var aux struct {
+		*dashboardData
+		LastMeasure flexInt64 `json:"time_utc"`
+		DateMaxTemp flexInt64 `json:"date_max_temp"`
+		DateMinTemp flexInt64 `json:"date_min_temp"`
+	}
+	aux.dashboardData = (*dashboardData)(dd)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	dd.LastMeasure = aux.LastMeasure.v
+	dd.DateMaxTemp = aux.DateMaxTemp.v
+	dd.DateMinTemp = aux.DateMinTemp.v
+	return nil
+}
+
+// flexInt64 decodes an optional integer sent either as a JSON number or as
+// a string.
+type flexInt64 struct {
+	v *int64
+}
+
+func (f *flexInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		f.v = nil
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	f.v = &n
+	return nil
+}
+
 // Place holds geolocation and location details.
 type Place struct {
 	Altitude *int32   `json:"altitude,omitempty"`
@@ -145,40 +357,188 @@ type Location struct {
 	Latitude  *float32
 }
 
+// UnmarshalJSON decodes Netatmo's [longitude, latitude] array. null leaves
+// both coordinates nil; other shapes are an error.
 func (tp *Location) UnmarshalJSON(data []byte) error {
-	a := []interface{}{&tp.Longitude, &tp.Latitude}
-	return json.Unmarshal(data, &a)
+	var a []*float32
+	if err := json.Unmarshal(data, &a); err != nil {
+		return fmt.Errorf("invalid location %s: %w", snippet(data, 50), err)
+	}
+	switch len(a) {
+	case 0:
+		if a == nil {
+			tp.Longitude, tp.Latitude = nil, nil
+			return nil
+		}
+	case 2:
+		tp.Longitude, tp.Latitude = a[0], a[1]
+		return nil
+	}
+	return fmt.Errorf("invalid location %s: want [longitude, latitude]", snippet(data, 50))
+}
+
+// MarshalJSON encodes the location as Netatmo does, i.e. [longitude, latitude].
+func (tp Location) MarshalJSON() ([]byte, error) {
+	if tp.Longitude == nil && tp.Latitude == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal([]*float32{tp.Longitude, tp.Latitude})
 }
 
 // savingSource wraps the oauth2.TokenSource to save tokens on refresh.
 type savingSource struct {
-	src oauth2.TokenSource
-	cfg *Config
+	src    oauth2.TokenSource
+	cfg    *Config
+	noSave bool
+	onErr  func(error)   // reports save errors; nil logs them
+	last   *oauth2.Token // latest token seen, guarded by cfg.mu
+}
+
+// sameToken reports whether a and b hold the same token state.
+func sameToken(a, b *oauth2.Token) bool {
+	return a.AccessToken == b.AccessToken && a.RefreshToken == b.RefreshToken && a.Expiry.Equal(b.Expiry)
 }
 
 func (s *savingSource) Token() (*oauth2.Token, error) {
 	token, err := s.src.Token()
 	if err != nil {
+		s.cfg.mu.Lock()
+		noRefresh := s.cfg.RefreshToken == ""
+		s.cfg.mu.Unlock()
+		if noRefresh {
+			return nil, ErrReauthRequired
+		}
 		return nil, err
 	}
 	s.cfg.mu.Lock()
+	if s.last != nil && sameToken(token, s.last) {
+		// Nothing to notify or save, and a deleted config stays deleted
+		s.cfg.mu.Unlock()
+		return token, nil
+	}
+	s.last = token
 	s.cfg.AccessToken = token.AccessToken
 	s.cfg.RefreshToken = token.RefreshToken
 	s.cfg.TokenValidUntil = token.Expiry
+	hasPath := s.cfg.path != ""
 	s.cfg.mu.Unlock()
 
+	if s.cfg.OnTokenRefresh != nil {
+		s.cfg.OnTokenRefresh(token)
+	}
+	// Configs not backed by a file are only kept in memory
+	if s.noSave || !hasPath {
+		return token, nil
+	}
 	if err := saveConfig(s.cfg); err != nil {
-		return nil, fmt.Errorf("error saving config: %w", err)
+		// The token is valid even if it could not be persisted
+		err = fmt.Errorf("error saving config: %w", err)
+		if s.onErr == nil {
+			log.Printf("netatmo: %v", err)
+		} else {
+			s.onErr(err)
+		}
 	}
 	return token, nil
 }
 
+// refreshSource obtains a new token on every call. Unlike the source of
+// oauth2.Config, it does not cache tokens itself, so that the refresh margin
+// of the ReuseTokenSource wrapping it applies.
+type refreshSource struct {
+	oauth *oauth2.Config
+	ctx   context.Context
+	retry RetryPolicy
+
+	mu           sync.Mutex // held during a refresh, not between retries
+	refreshToken string
+	last         *oauth2.Token // latest refreshed token
+}
+
+func (s *refreshSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+
+	delay := s.retry.Delay
+	for attempt := 0; ; attempt++ {
+		s.mu.Lock()
+		if s.last != last {
+			// Another call refreshed the token while this one waited
+			token := s.last
+			s.mu.Unlock()
+			return token, nil
+		}
+		refreshToken := s.refreshToken
+		token, err := s.oauth.TokenSource(s.ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+		if err == nil {
+			s.refreshToken, s.last = token.RefreshToken, token
+		}
+		s.mu.Unlock()
+
+		if err == nil {
+			return token, nil
+		}
+		if attempt >= s.retry.MaxRetries || refreshToken == "" || !retryableRefreshError(err) {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// retryableRefreshError reports whether a failed refresh may succeed when
+// retried: network errors and server errors, but not rejected grants.
+func retryableRefreshError(err error) bool {
+	var rerr *oauth2.RetrieveError
+	if errors.As(err, &rerr) {
+		return rerr.Response != nil && rerr.Response.StatusCode >= 500
+	}
+	return true
+}
+
+// RetryPolicy describes how failed requests are retried.
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt, 0 for none
+	Delay      time.Duration // before the first retry, doubled for each next one
+}
+
 // NewClient initializes the Netatmo client with automatic token persistence.
-func NewClient(cfg *Config) (*Client, error) {
-	oauthCfg := &oauth2.Config{
+func NewClient(cfg *Config, opts ...Option) (*Client, error) {
+	client := &Client{
+		baseCtx:    context.Background(),
+		appType:    AppStation,
+		baseURL:    baseURL,
+		maxSeedAge: 24 * time.Hour,
+		margin:     time.Minute,
+		Dc:         &DeviceCollection{},
+		cfg:        cfg,
+		homesData:  ttlCache{ttl: defaultHomesDataTTL},
+		homeStatus: ttlCache{ttl: defaultHomeStatusTTL},
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	// A long expired token without refresh token can never be used
+	if cfg.RefreshToken == "" && !cfg.TokenValidUntil.IsZero() && client.maxSeedAge >= 0 &&
+		time.Since(cfg.TokenValidUntil) > client.maxSeedAge {
+		return nil, ErrReauthRequired
+	}
+
+	client.oauth = &oauth2.Config{
 		ClientID:     cfg.ClientID,
 		ClientSecret: cfg.ClientSecret,
-		Endpoint:     oauth2.Endpoint{TokenURL: authURL},
+		Endpoint:     oauth2.Endpoint{TokenURL: client.baseURL + authPath},
+	}
+	if client.tokenURL != "" {
+		client.oauth.Endpoint.TokenURL = client.tokenURL
 	}
 
 	// Seed the token (may be expired)
@@ -188,21 +548,114 @@ func NewClient(cfg *Config) (*Client, error) {
 		Expiry:       cfg.TokenValidUntil,
 	}
 
-	reuse := oauth2.ReuseTokenSource(seed, oauthCfg.TokenSource(context.Background(), seed))
-	saving := &savingSource{src: reuse, cfg: cfg}
-
-	client := &Client{
-		oauth:      oauthCfg,
-		httpClient: oauth2.NewClient(context.Background(), saving),
-		Dc:         &DeviceCollection{},
-		cfg:        cfg,
+	// Use a dedicated transport so idle connections can be closed on Close
+	client.transport = http.DefaultTransport.(*http.Transport).Clone()
+	if client.insecure {
+		client.transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	for _, tune := range client.tuneRT {
+		tune(client.transport)
 	}
+	client.baseRT = client.transport
+	if client.signer != nil {
+		client.baseRT = &signingTransport{next: client.baseRT, sign: client.signer}
+	}
+	if client.wrapRT != nil {
+		client.baseRT = client.wrapRT(client.baseRT)
+	}
+	ctx := context.WithValue(client.baseCtx, oauth2.HTTPClient, &http.Client{Transport: client.baseRT})
+
+	refresh := &refreshSource{oauth: client.oauth, ctx: ctx, retry: client.tokenRetry, refreshToken: seed.RefreshToken}
+	reuse := oauth2.ReuseTokenSourceWithExpiry(seed, refresh, client.margin)
+	client.tokenSrc = &savingSource{src: reuse, cfg: cfg, noSave: client.noSave, onErr: client.onSaveErr, last: seed}
+	// Not oauth2.NewClient: its ReuseTokenSource would reset the expiry
+	// margin of refreshed tokens to the default. This one also keeps
+	// savingSource from being called on every request.
+	client.httpClient = &http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.ReuseTokenSourceWithExpiry(nil, client.tokenSrc, client.margin),
+		Base:   client.baseRT,
+	}}
+
 	return client, nil
 }
 
+// NewClientWithCredentials initializes a Netatmo client from credentials
+// rather than a config file. Refreshed tokens are only kept in memory.
+func NewClientWithCredentials(clientID, clientSecret, accessToken, refreshToken string, expiry time.Time, opts ...Option) (*Client, error) {
+	cfg := &Config{
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		AccessToken:     accessToken,
+		RefreshToken:    refreshToken,
+		TokenValidUntil: expiry,
+	}
+	return NewClient(cfg, opts...)
+}
+
+// TokenSource returns the token source used by the client. Tokens obtained
+// from it are refreshed and saved to the config file like the client's own.
+func (c *Client) TokenSource() oauth2.TokenSource {
+	return c.tokenSrc
+}
+
+// Close stops auto refresh, releases idle connections and saves the current
+// token state to the config file. The client must not be used after Close.
+func (c *Client) Close() error {
+	c.StopAutoRefresh()
+	c.transport.CloseIdleConnections()
+	if c.noSave || c.cfg.path == "" {
+		return nil
+	}
+	return saveConfig(c.cfg)
+}
+
+// Revoke revokes the refresh token with Netatmo and clears the tokens
+// stored in the config. The client cannot be used afterwards. It fails
+// without a request if the config has no refresh token.
+func (c *Client) Revoke(ctx context.Context) error {
+	c.cfg.mu.Lock()
+	token := c.cfg.RefreshToken
+	c.cfg.mu.Unlock()
+	if token == "" {
+		return errors.New("no refresh token to revoke")
+	}
+
+	data := url.Values{
+		"client_id":     {c.cfg.ClientID},
+		"client_secret": {c.cfg.ClientSecret},
+		"token":         {token},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+revokePath, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Not sent through the OAuth2 client, which could try to refresh the token
+	resp, err := (&http.Client{Transport: c.baseRT}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad HTTP status: %d", resp.StatusCode)
+	}
+
+	c.cfg.mu.Lock()
+	c.cfg.AccessToken = ""
+	c.cfg.RefreshToken = ""
+	c.cfg.TokenValidUntil = time.Time{}
+	c.cfg.mu.Unlock()
+
+	if c.noSave || c.cfg.path == "" {
+		return nil
+	}
+	return saveConfig(c.cfg)
+}
+
 // doHTTPPostForm submits a POST form.
-func (c *Client) doHTTPPostForm(urlStr string, data url.Values) (*http.Response, error) {
-	req, err := http.NewRequest("POST", urlStr, strings.NewReader(data.Encode()))
+func (c *Client) doHTTPPostForm(ctx context.Context, urlStr string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -210,12 +663,26 @@ func (c *Client) doHTTPPostForm(urlStr string, data url.Values) (*http.Response,
 	return c.doHTTP(req)
 }
 
+// doHTTPPostJSON submits a POST request with body encoded as JSON.
+func (c *Client) doHTTPPostJSON(ctx context.Context, urlStr string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.doHTTP(req)
+}
+
 // doHTTPGet submits a GET request.
-func (c *Client) doHTTPGet(urlStr string, data url.Values) (*http.Response, error) {
+func (c *Client) doHTTPGet(ctx context.Context, urlStr string, data url.Values) (*http.Response, error) {
 	if data != nil {
 		urlStr += "?" + data.Encode()
 	}
-	req, err := http.NewRequest("GET", urlStr, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -224,7 +691,105 @@ func (c *Client) doHTTPGet(urlStr string, data url.Values) (*http.Response, erro
 
 // doHTTP executes an *http.Request using the OAuth2 client.
 func (c *Client) doHTTP(req *http.Request) (*http.Response, error) {
-	return c.httpClient.Do(req)
+	timeout, ok := c.timeouts[path.Base(req.URL.Path)]
+	if !ok {
+		timeout = c.timeouts[""]
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return resp, asAuthError(err)
+	}
+	c.headerMu.Lock()
+	c.lastHeader = resp.Header.Clone()
+	c.headerMu.Unlock()
+
+	if c.decoder != nil {
+		defer cancel()
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = c.decoder(resp.StatusCode, resp.Header, data); err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		resp.ContentLength = int64(len(data))
+		return resp, nil
+	}
+
+	// The timeout also covers reading the body
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// ResponseDecoder transforms the body of an API response before it is
+// checked and decoded as usual, e.g. to strip a byte order mark or unwrap a
+// proxy's envelope. It receives the HTTP status, headers and raw body, and
+// returns the body to process. An error fails the request.
+type ResponseDecoder func(status int, header http.Header, body []byte) ([]byte, error)
+
+// LastResponseHeaders returns the HTTP headers of the latest API response,
+// e.g. to inspect rate limit or diagnostic headers.
+func (c *Client) LastResponseHeaders() http.Header {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
+	return c.lastHeader.Clone()
+}
+
+// cancelBody cancels the request context once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// RequestSigner adds headers computed from a request, such as an HMAC
+// signature required by a gateway, just before it is sent. body is a copy
+// of the request body, nil if there is none. An error fails the request.
+type RequestSigner func(req *http.Request, body []byte) error
+
+// signingTransport signs requests before passing them to next.
+type signingTransport struct {
+	next http.RoundTripper
+	sign RequestSigner
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	if err := t.sign(req, body); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
 }
 
 // processHTTPResponse checks status and unmarshals JSON.
@@ -235,15 +800,23 @@ func processHTTPResponse(resp *http.Response, err error, holder interface{}) (js
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad HTTP status: %d", resp.StatusCode)
-	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	// Netatmo's gateway answers with HTML error pages during outages
+	if isHTML(resp, data) {
+		return nil, fmt.Errorf("unexpected HTML response (HTTP status %d): %s", resp.StatusCode, snippet(data, 200))
+	}
+	if resp.StatusCode != http.StatusOK {
+		if apiErr := parseAPIError(resp, data); apiErr != nil {
+			return nil, apiErr
+		}
+		return nil, fmt.Errorf("bad HTTP status: %d", resp.StatusCode)
+	}
+
 	err = json.Unmarshal(data, holder)
 	if err != nil {
 		return nil, err
@@ -252,14 +825,180 @@ func processHTTPResponse(resp *http.Response, err error, holder interface{}) (js
 	return data, nil
 }
 
-// Read retrieves station/module data.
+// isHTML reports whether the response is an HTML page rather than JSON.
+func isHTML(resp *http.Response, data []byte) bool {
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "<")
+}
+
+// snippet returns the start of data as a single line of at most n bytes.
+func snippet(data []byte, n int) string {
+	s := strings.Join(strings.Fields(string(data)), " ")
+	if len(s) > n {
+		s = s[:n] + "..."
+	}
+	return s
+}
+
+// StationReader is implemented by *Client. Depend on it rather than on
+// *Client to be able to substitute a test double.
+type StationReader interface {
+	Read() (*DeviceCollection, json.RawMessage, error)
+}
+
+// ContextStationReader is the context-aware variant of StationReader.
+type ContextStationReader interface {
+	ReadContext(ctx context.Context) (*DeviceCollection, json.RawMessage, error)
+}
+
+var (
+	_ StationReader        = (*Client)(nil)
+	_ ContextStationReader = (*Client)(nil)
+)
+
+// Read retrieves station/module data. Each call returns a new collection,
+// which also replaces c.Dc, instead of decoding into c.Dc in place, so
+// collections returned earlier are never modified. The request uses the
+// context set by WithBaseContext.
 func (c *Client) Read() (*DeviceCollection, json.RawMessage, error) {
-	resp, err := c.doHTTPGet(deviceURL, url.Values{"app_type": {"app_station"}})
-	j, err := processHTTPResponse(resp, err, c.Dc)
+	return c.ReadContext(c.baseCtx)
+}
+
+// ReadContext retrieves station/module data using ctx for the request. While
+// auto refresh is running, it returns the latest refreshed data instead.
+// Concurrent calls share a single API request and its result. The shared
+// request keeps the values of the first caller's ctx but not its
+// cancellation, so that callers giving up do not fail the others; it is
+// bounded by the timeouts of WithTimeout and WithEndpointTimeout. Each
+// caller returns when its own ctx is done.
+func (c *Client) ReadContext(ctx context.Context) (*DeviceCollection, json.RawMessage, error) {
+	if dc, j, ok, err := c.autoRefreshed(ctx); ok || err != nil {
+		if ok {
+			c.setCollection(dc)
+		}
+		return dc, j, err
+	}
+
+	type result struct {
+		dc *DeviceCollection
+		j  json.RawMessage
+	}
+	shared := context.WithoutCancel(ctx)
+	ch := c.reads.DoChan("read", func() (interface{}, error) {
+		dc, j, err := c.fetch(shared)
+		return result{dc, j}, err
+	})
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if res.Err != nil {
+		return nil, nil, res.Err
+	}
+	r := res.Val.(result)
+	c.setCollection(r.dc)
+	return r.dc, r.j, nil
+}
+
+// Collection returns the collection of the latest Read, ReadContext or
+// ReadJSON. Each of them replaces it with a new collection rather than
+// updating it in place, so a collection obtained earlier is never modified.
+// Unlike the Dc field, Collection is safe to call concurrently with reads.
+func (c *Client) Collection() *DeviceCollection {
+	c.dcMu.Lock()
+	defer c.dcMu.Unlock()
+	return c.Dc
+}
+
+// setCollection replaces the collection returned by Collection.
+func (c *Client) setCollection(dc *DeviceCollection) {
+	c.dcMu.Lock()
+	c.Dc = dc
+	c.dcMu.Unlock()
+}
+
+// fetch retrieves station/module data into a new collection. It does not
+// set c.Dc, which is left to the caller so that background refreshes do not
+// race with readers of the field. If the previous response carried an ETag or Last-Modified
+// header, the request is conditional and a 304 Not Modified response returns
+// the previous collection.
+func (c *Client) fetch(ctx context.Context) (*DeviceCollection, json.RawMessage, error) {
+	urlStr := c.baseURL + devicePath + "?" + url.Values{"app_type": {c.appType}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return nil, nil, err
 	}
-	return c.Dc, j, nil
+
+	c.condMu.Lock()
+	prev := c.lastRead
+	c.condMu.Unlock()
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
+	resp, err := c.doHTTP(req)
+	if err == nil && resp.StatusCode == http.StatusNotModified && prev != nil {
+		resp.Body.Close()
+		return prev.dc, prev.raw, nil
+	}
+
+	dc := &DeviceCollection{}
+	j, err := processHTTPResponse(resp, err, dc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.userUnits {
+		dc.applyUnits()
+	}
+
+	c.condMu.Lock()
+	c.lastRead = &conditionalRead{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		dc:           dc,
+		raw:          j,
+	}
+	if c.lastRead.etag == "" && c.lastRead.lastModified == "" {
+		c.lastRead = nil
+	}
+	c.condMu.Unlock()
+	return dc, j, nil
+}
+
+// conditionalRead is the response to a Read with the validators needed to
+// make the next one conditional.
+type conditionalRead struct {
+	etag         string
+	lastModified string
+	dc           *DeviceCollection
+	raw          json.RawMessage
+}
+
+// ReadJSON loads station/module data from a getstationsdata response read
+// from r instead of the API, e.g. a payload previously saved from Read.
+func (c *Client) ReadJSON(r io.Reader) (*DeviceCollection, json.RawMessage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	dc := &DeviceCollection{}
+	if err := json.Unmarshal(data, dc); err != nil {
+		return nil, nil, err
+	}
+	if c.userUnits {
+		dc.applyUnits()
+	}
+	c.setCollection(dc)
+	return dc, data, nil
 }
 
 // Devices returns the list of devices
@@ -272,17 +1011,64 @@ func (dc *DeviceCollection) Stations() []*Device {
 	return dc.Devices()
 }
 
-// Modules returns associated device module
+// OwnedStations returns the stations owned by the user, leaving out those
+// shared with them or marked as favorites.
+func (dc *DeviceCollection) OwnedStations() []*Device {
+	var owned []*Device
+	for _, station := range dc.Stations() {
+		if station.ReadOnly == nil || !*station.ReadOnly {
+			owned = append(owned, station)
+		}
+	}
+	return owned
+}
+
+// findModule returns the station or module with the given ID.
+func (dc *DeviceCollection) findModule(id string) (*Device, bool) {
+	for _, station := range dc.Stations() {
+		for _, module := range station.Modules() {
+			if module.ID == id {
+				return module, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Walk calls fn for every module of every station, including the base
+// station itself, for which station and module are the same Device.
+func (dc *DeviceCollection) Walk(fn func(station, module *Device)) {
+	for _, station := range dc.Stations() {
+		for _, module := range station.Modules() {
+			fn(station, module)
+		}
+	}
+}
+
+// Modules returns associated device module. Nil entries of LinkedModules
+// are skipped.
 func (d *Device) Modules() []*Device {
-	list := append([]*Device(nil), d.LinkedModules...)
-	return append(list, d)
+	return append(d.linked(), d)
+}
+
+// linked returns a copy of LinkedModules without nil entries, which
+// hand-built collections may contain.
+func (d *Device) linked() []*Device {
+	list := make([]*Device, 0, len(d.LinkedModules)+1)
+	for _, m := range d.LinkedModules {
+		if m != nil {
+			list = append(list, m)
+		}
+	}
+	return list
 }
 
-// Data returns timestamp and the list of sensor value for this module
+// Data returns timestamp and the list of sensor value for this module.
+// DateMinTemp and DateMaxTemp are time.Time values, in UTC.
 func (d *Device) Data() (int64, map[string]interface{}) {
 
 	// return only populate field of DashboardData
-	m := make(map[string]interface{})
+	m := make(map[string]interface{}, 20)
 
 	if d.DashboardData.Temperature != nil {
 		m["Temperature"] = *d.DashboardData.Temperature
@@ -293,6 +1079,12 @@ func (d *Device) Data() (int64, map[string]interface{}) {
 	if d.DashboardData.MaxTemp != nil {
 		m["MaxTemp"] = *d.DashboardData.MaxTemp
 	}
+	if t, ok := d.DashboardData.MinTempTime(); ok {
+		m["DateMinTemp"] = t
+	}
+	if t, ok := d.DashboardData.MaxTempTime(); ok {
+		m["DateMaxTemp"] = t
+	}
 	if d.DashboardData.TempTrend != "" {
 		m["TempTrend"] = d.DashboardData.TempTrend
 	}
@@ -342,11 +1134,21 @@ func (d *Device) Data() (int64, map[string]interface{}) {
 	return *d.DashboardData.LastMeasure, m
 }
 
+// allValues returns timestamp and the values of both Data and Info.
+func (d *Device) allValues() (int64, map[string]interface{}) {
+	ts, m := d.Data()
+	_, info := d.Info()
+	for k, v := range info {
+		m[k] = v
+	}
+	return ts, m
+}
+
 // Info returns timestamp and the list of info value for this module
 func (d *Device) Info() (int64, map[string]interface{}) {
 
 	// return only populate field of DashboardData
-	m := make(map[string]interface{})
+	m := make(map[string]interface{}, 3)
 
 	// Return data from module level
 	if d.BatteryPercent != nil {
@@ -361,3 +1163,27 @@ func (d *Device) Info() (int64, map[string]interface{}) {
 
 	return *d.DashboardData.LastMeasure, m
 }
+
+// Round returns a copy of dd with all floating point measurements rounded to
+// the given number of decimal places.
+func (dd DashboardData) Round(places int) DashboardData {
+	dd.Temperature = roundFloat32(dd.Temperature, places)
+	dd.MaxTemp = roundFloat32(dd.MaxTemp, places)
+	dd.MinTemp = roundFloat32(dd.MinTemp, places)
+	dd.Pressure = roundFloat32(dd.Pressure, places)
+	dd.AbsolutePressure = roundFloat32(dd.AbsolutePressure, places)
+	dd.Rain = roundFloat32(dd.Rain, places)
+	dd.Rain1Hour = roundFloat32(dd.Rain1Hour, places)
+	dd.Rain1Day = roundFloat32(dd.Rain1Day, places)
+	return dd
+}
+
+// roundFloat32 rounds *v to places decimals, returning a new pointer.
+func roundFloat32(v *float32, places int) *float32 {
+	if v == nil {
+		return nil
+	}
+	pow := math.Pow(10, float64(places))
+	r := float32(math.Round(float64(*v)*pow) / pow)
+	return &r
+}
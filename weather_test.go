@@ -0,0 +1,144 @@
+package netatmo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func float32p(v float32) *float32 { return &v }
+func int64p(v int64) *int64       { return &v }
+
+// nilModuleCollection returns a station whose linked modules include nil,
+// as hand-built collections may.
+func nilModuleCollection() *DeviceCollection {
+	outdoor := &Device{
+		ID:            "02:00:00:00:00:01",
+		ModuleName:    "Outdoor",
+		Type:          TypeOutdoor,
+		DashboardData: DashboardData{LastMeasure: int64p(100), Temperature: float32p(12.5)},
+	}
+	station := &Device{
+		ID:            "70:ee:50:00:00:01",
+		StationName:   "Home",
+		Type:          TypeStation,
+		DashboardData: DashboardData{LastMeasure: int64p(100), Temperature: float32p(21)},
+		LinkedModules: []*Device{nil, outdoor, nil},
+	}
+	dc := &DeviceCollection{}
+	dc.Body.Devices = []*Device{station}
+	return dc
+}
+
+func TestModulesSkipsNil(t *testing.T) {
+	station := nilModuleCollection().Stations()[0]
+	modules := station.Modules()
+	if len(modules) != 2 {
+		t.Fatalf("Modules() returned %d devices, want 2", len(modules))
+	}
+	for i, m := range modules {
+		if m == nil {
+			t.Fatalf("Modules()[%d] is nil", i)
+		}
+	}
+	if modules[1] != station {
+		t.Errorf("Modules() does not end with the station itself")
+	}
+}
+
+func TestWalkSkipsNilModules(t *testing.T) {
+	var ids []string
+	nilModuleCollection().Walk(func(station, module *Device) {
+		if module == nil {
+			t.Fatal("Walk called fn with a nil module")
+		}
+		ids = append(ids, module.ID)
+	})
+	if got := strings.Join(ids, ","); got != "02:00:00:00:00:01,70:ee:50:00:00:01" {
+		t.Errorf("Walk visited %s", got)
+	}
+}
+
+func TestFlattenSkipsNilModules(t *testing.T) {
+	records := nilModuleCollection().Flatten()
+	if len(records) != 2 {
+		t.Fatalf("Flatten() returned %d records, want 2", len(records))
+	}
+	for _, r := range records {
+		if r.Metric != "Temperature" {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+}
+
+func TestWriteDOTSkipsNilModules(t *testing.T) {
+	var buf bytes.Buffer
+	if err := nilModuleCollection().WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), " -> "); got != 1 {
+		t.Errorf("WriteDOT wrote %d edges, want 1:\n%s", got, buf.String())
+	}
+}
+
+func TestReadContextCancelDoesNotFailSharedRead(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":{"devices":[{"_id":"70:ee:50:00:00:01","type":"NAMain"}]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClientWithCredentials("id", "secret", "token", "refresh", time.Now().Add(time.Hour), WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := c.ReadContext(ctx)
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		dc, _, err := c.ReadContext(context.Background())
+		if err == nil && len(dc.Stations()) != 1 {
+			err = errors.New("shared read returned no station")
+		}
+		second <- err
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("other caller got %v", err)
+	}
+}
+
+func TestReadUsesBaseContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, err := NewClientWithCredentials("id", "secret", "token", "refresh", time.Now().Add(time.Hour),
+		WithBaseURL(newAPIServer(t).URL), WithBaseContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Read(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read with a canceled base context returned %v, want context.Canceled", err)
+	}
+}